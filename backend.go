@@ -0,0 +1,115 @@
+package wrengo
+
+import "weak"
+
+// Backend is the set of Wren C API entry points the bindings call into. Each method corresponds to the Wren
+// function of the same name (e.g. SetSlotDouble() is wrenSetSlotDouble()), with vm being the WrenVM* pointer
+// returned from NewVM().
+//
+// By default, the bindings load Wren as a shared library through purego (see Load()); building with the
+// wrengo_static tag (and cgo) adds a backend that links Wren statically instead (see LoadStatic()). Either
+// way, VMs and CallHandles work the same.
+type Backend interface {
+	// VersionNumber returns the Wren version number, encoded as major * 1000000 + minor * 1000 + patch.
+	VersionNumber() int
+	// HasFunction returns true if the backend provides the named Wren C API function (e.g. "wrenAbortFiber").
+	HasFunction(name string) bool
+
+	NewVM(config *BackendConfig) uintptr
+	FreeVM(vm uintptr)
+	Interpret(vm uintptr, module, source string) int
+
+	// Reallocate resizes (or allocates, if memory is 0) a block of memory using the C allocator Wren uses by
+	// default, like C's realloc(). If newSize is 0, the memory is freed and 0 is returned.
+	Reallocate(memory uintptr, newSize uintptr) uintptr
+
+	EnsureSlots(vm uintptr, slotCount int)
+	GetSlotCount(vm uintptr) int
+	GetSlotType(vm uintptr, slot int) int
+
+	SetSlotBool(vm uintptr, slot int, value bool)
+	SetSlotDouble(vm uintptr, slot int, value float64)
+	SetSlotNull(vm uintptr, slot int)
+	SetSlotBytes(vm uintptr, slot int, bytes []byte)
+	SetSlotString(vm uintptr, slot int, text string)
+
+	GetSlotBool(vm uintptr, slot int) bool
+	GetSlotDouble(vm uintptr, slot int) float64
+	GetSlotString(vm uintptr, slot int) string
+	GetSlotBytes(vm uintptr, slot int) []byte
+
+	SetSlotNewList(vm uintptr, slot int)
+	GetListCount(vm uintptr, slot int) int
+	GetListElement(vm uintptr, listSlot, index, elementSlot int)
+	SetListElement(vm uintptr, listSlot, index, elementSlot int)
+	InsertInList(vm uintptr, listSlot, index, elementSlot int)
+
+	SetSlotNewMap(vm uintptr, slot int)
+	GetMapCount(vm uintptr, slot int) int
+	GetMapContainsKey(vm uintptr, mapSlot, keySlot int) bool
+	GetMapKey(vm uintptr, mapSlot, index, keySlot int)
+	GetMapValue(vm uintptr, mapSlot, keySlot, valueSlot int)
+	SetMapValue(vm uintptr, mapSlot, keySlot, valueSlot int)
+	RemoveMapValue(vm uintptr, mapSlot, keySlot, removedValueSlot int)
+
+	MakeCallHandle(vm uintptr, signature string) uintptr
+	Call(vm uintptr, method uintptr) int
+	GetSlotHandle(vm uintptr, slot int) uintptr
+	SetSlotHandle(vm uintptr, slot int, handle uintptr)
+	ReleaseHandle(vm uintptr, handle uintptr)
+
+	GetVariable(vm uintptr, module, name string, slot int)
+	HasVariable(vm uintptr, module, name string) bool
+	HasModule(vm uintptr, module string) bool
+
+	// Optional functions; only called if HasFunction() reports them.
+	AbortFiber(vm uintptr, slot int)
+	CollectGarbage(vm uintptr)
+	// SetSlotNewForeign creates an instance of the foreign class in classSlot in the given slot, with size bytes
+	// of data, and returns the address of the data. GetSlotForeign returns the address of the data of the foreign
+	// object in the slot; it must be the same address SetSlotNewForeign() returned for it.
+	SetSlotNewForeign(vm uintptr, slot, classSlot int, size uintptr) uintptr
+	GetSlotForeign(vm uintptr, slot int) uintptr
+
+	// Close releases the backend (e.g. unloading the shared library). It's called once all VMs are freed.
+	Close() error
+}
+
+// BackendConfig holds the settings and callbacks a Backend uses to create a VM. It corresponds to Wren's
+// WrenConfiguration, but with the callbacks being Go functions rather than C function pointers; each backend is
+// responsible for calling them from its own C callbacks. Nil callbacks are left unset in Wren, and heap settings
+// of 0 use Wren's defaults.
+type BackendConfig struct {
+	// Reallocate is called for every allocation, reallocation and deallocation Wren makes, with the same
+	// semantics as Backend.Reallocate(). It's also called before the VM exists, to allocate the VM itself.
+	Reallocate func(memory uintptr, newSize uintptr) uintptr
+	// Write is called to print text from System.print() and friends.
+	Write func(vm uintptr, text string)
+	// Error is called to report compile errors, runtime errors, and stack trace lines.
+	Error func(vm uintptr, errorType int, module string, line int, message string)
+	// ResolveModule returns the canonical name of the module imported by importer. The backend must copy the
+	// returned name into memory allocated with the VM's allocator (Reallocate, if it's set), as Wren frees it.
+	ResolveModule func(vm uintptr, importer, name string) string
+	// LoadModule returns the source of the named module, or nil if it can't be found.
+	LoadModule func(vm uintptr, name string) []byte
+	// BindForeignMethod returns the Go function to call for the foreign method, or nil if there isn't one.
+	BindForeignMethod func(vm uintptr, module, className string, isStatic bool, signature string) func(vm uintptr)
+	// BindForeignClass returns the Go function that allocates instances of the foreign class (by calling
+	// SetSlotNewForeign() with the class in slot 0), or nil if there isn't one.
+	BindForeignClass func(vm uintptr, module, className string) func(vm uintptr)
+	// FinalizeForeign is called with the data of every foreign object created with SetSlotNewForeign() once Wren
+	// frees it, whatever its class. Wren gives finalizers nothing but the data, so it's up to the backend to
+	// find the VM's configuration from it. FinalizeForeign never calls into the VM.
+	FinalizeForeign func(data uintptr)
+
+	InitialHeapSize   int
+	MinHeapSize       int
+	HeapGrowthPercent int
+
+	vm weak.Pointer[VM] // The VM the configuration is for, for the fake backend to hand to OnInterpret
+}
+
+// LoadBackend creates a Library that uses the given Backend, rather than loading Wren as a shared library.
+func LoadBackend(backend Backend) (*Library, error) {
+	return newLibrary(backend, "")
+}
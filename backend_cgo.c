@@ -0,0 +1,121 @@
+//go:build cgo && wrengo_static
+
+// This file compiles the vendored Wren sources, along with the C callbacks that forward to the Go functions
+// exported from backend_cgo.go.
+
+#include <stdlib.h>
+#include "wren.c"
+#include "_cgo_export.h"
+
+#define WRENGO_CALLBACK_WRITE 1
+#define WRENGO_CALLBACK_ERROR 2
+#define WRENGO_CALLBACK_LOAD_MODULE 4
+#define WRENGO_CALLBACK_BIND_FOREIGN_METHOD 8
+#define WRENGO_CALLBACK_REALLOCATE 16
+#define WRENGO_CALLBACK_RESOLVE_MODULE 32
+#define WRENGO_CALLBACK_BIND_FOREIGN_CLASS 64
+
+static void* wrengoReallocateFn(void* memory, size_t newSize, void* userData) {
+	return (void*)wrengoReallocate((uintptr_t)userData, (uintptr_t)memory, newSize);
+}
+
+static void wrengoWriteFn(WrenVM* vm, const char* text) {
+	wrengoWrite(vm, (char*)text);
+}
+
+static void wrengoErrorFn(WrenVM* vm, WrenErrorType errorType, const char* module, int line, const char* message) {
+	wrengoError(vm, (int)errorType, (char*)module, line, (char*)message);
+}
+
+static const char* wrengoResolveModuleFn(WrenVM* vm, const char* importer, const char* name) {
+	return wrengoResolveModule(vm, (char*)importer, (char*)name);
+}
+
+static void wrengoLoadModuleComplete(WrenVM* vm, const char* name, WrenLoadModuleResult result) {
+	free((void*)result.source);
+}
+
+static WrenLoadModuleResult wrengoLoadModuleFn(WrenVM* vm, const char* name) {
+	WrenLoadModuleResult result = {0};
+	result.source = wrengoLoadModule(vm, (char*)name);
+	if (result.source != NULL) {
+		result.onComplete = wrengoLoadModuleComplete;
+	}
+	return result;
+}
+
+// Wren's foreign methods only receive the VM, so each bound method of a VM gets its own trampoline that
+// passes its index along to Go. WRENGO_TRAMPOLINES must match cgoForeignTrampolines.
+#define WRENGO_TRAMPOLINES 1000
+
+#define WRENGO_FOREIGN(a, b, c) \
+	static void wrengoForeign_##a##b##c(WrenVM* vm) { wrengoCallForeign(vm, a * 100 + b * 10 + c); }
+#define WRENGO_FOREIGN_10(a, b) \
+	WRENGO_FOREIGN(a, b, 0) WRENGO_FOREIGN(a, b, 1) WRENGO_FOREIGN(a, b, 2) WRENGO_FOREIGN(a, b, 3) WRENGO_FOREIGN(a, b, 4) \
+	WRENGO_FOREIGN(a, b, 5) WRENGO_FOREIGN(a, b, 6) WRENGO_FOREIGN(a, b, 7) WRENGO_FOREIGN(a, b, 8) WRENGO_FOREIGN(a, b, 9)
+#define WRENGO_FOREIGN_100(a) \
+	WRENGO_FOREIGN_10(a, 0) WRENGO_FOREIGN_10(a, 1) WRENGO_FOREIGN_10(a, 2) WRENGO_FOREIGN_10(a, 3) WRENGO_FOREIGN_10(a, 4) \
+	WRENGO_FOREIGN_10(a, 5) WRENGO_FOREIGN_10(a, 6) WRENGO_FOREIGN_10(a, 7) WRENGO_FOREIGN_10(a, 8) WRENGO_FOREIGN_10(a, 9)
+
+WRENGO_FOREIGN_100(0) WRENGO_FOREIGN_100(1) WRENGO_FOREIGN_100(2) WRENGO_FOREIGN_100(3) WRENGO_FOREIGN_100(4)
+WRENGO_FOREIGN_100(5) WRENGO_FOREIGN_100(6) WRENGO_FOREIGN_100(7) WRENGO_FOREIGN_100(8) WRENGO_FOREIGN_100(9)
+
+#define WRENGO_FOREIGN_REF(a, b, c) wrengoForeign_##a##b##c,
+#define WRENGO_FOREIGN_REF_10(a, b) \
+	WRENGO_FOREIGN_REF(a, b, 0) WRENGO_FOREIGN_REF(a, b, 1) WRENGO_FOREIGN_REF(a, b, 2) WRENGO_FOREIGN_REF(a, b, 3) WRENGO_FOREIGN_REF(a, b, 4) \
+	WRENGO_FOREIGN_REF(a, b, 5) WRENGO_FOREIGN_REF(a, b, 6) WRENGO_FOREIGN_REF(a, b, 7) WRENGO_FOREIGN_REF(a, b, 8) WRENGO_FOREIGN_REF(a, b, 9)
+#define WRENGO_FOREIGN_REF_100(a) \
+	WRENGO_FOREIGN_REF_10(a, 0) WRENGO_FOREIGN_REF_10(a, 1) WRENGO_FOREIGN_REF_10(a, 2) WRENGO_FOREIGN_REF_10(a, 3) WRENGO_FOREIGN_REF_10(a, 4) \
+	WRENGO_FOREIGN_REF_10(a, 5) WRENGO_FOREIGN_REF_10(a, 6) WRENGO_FOREIGN_REF_10(a, 7) WRENGO_FOREIGN_REF_10(a, 8) WRENGO_FOREIGN_REF_10(a, 9)
+
+static WrenForeignMethodFn wrengoForeignTrampolines[WRENGO_TRAMPOLINES] = {
+	WRENGO_FOREIGN_REF_100(0) WRENGO_FOREIGN_REF_100(1) WRENGO_FOREIGN_REF_100(2) WRENGO_FOREIGN_REF_100(3) WRENGO_FOREIGN_REF_100(4)
+	WRENGO_FOREIGN_REF_100(5) WRENGO_FOREIGN_REF_100(6) WRENGO_FOREIGN_REF_100(7) WRENGO_FOREIGN_REF_100(8) WRENGO_FOREIGN_REF_100(9)
+};
+
+static WrenForeignMethodFn wrengoBindForeignMethodFn(WrenVM* vm, const char* module, const char* className, bool isStatic, const char* signature) {
+	int index = wrengoBindForeignMethod(vm, (char*)module, (char*)className, isStatic, (char*)signature);
+	if (index < 0 || index >= WRENGO_TRAMPOLINES) {
+		return NULL;
+	}
+	return wrengoForeignTrampolines[index];
+}
+
+static void wrengoFinalizeFn(void* data) {
+	wrengoFinalize((uintptr_t)data);
+}
+
+// Foreign class allocators are called the same way as foreign methods, so they share the VM's trampolines.
+static WrenForeignClassMethods wrengoBindForeignClassFn(WrenVM* vm, const char* module, const char* className) {
+	WrenForeignClassMethods methods = {0};
+	int index = wrengoBindForeignClass(vm, (char*)module, (char*)className);
+	if (index >= 0 && index < WRENGO_TRAMPOLINES) {
+		methods.allocate = wrengoForeignTrampolines[index];
+		methods.finalize = wrengoFinalizeFn;
+	}
+	return methods;
+}
+
+WrenVM* wrengoNewVM(size_t initialHeapSize, size_t minHeapSize, int heapGrowthPercent, int callbacks, uintptr_t id) {
+
+	WrenConfiguration config;
+	wrenInitConfiguration(&config);
+
+	if (initialHeapSize > 0) config.initialHeapSize = initialHeapSize;
+	if (minHeapSize > 0) config.minHeapSize = minHeapSize;
+	if (heapGrowthPercent > 0) config.heapGrowthPercent = heapGrowthPercent;
+
+	if (callbacks & WRENGO_CALLBACK_WRITE) config.writeFn = wrengoWriteFn;
+	if (callbacks & WRENGO_CALLBACK_ERROR) config.errorFn = wrengoErrorFn;
+	if (callbacks & WRENGO_CALLBACK_LOAD_MODULE) config.loadModuleFn = wrengoLoadModuleFn;
+	if (callbacks & WRENGO_CALLBACK_BIND_FOREIGN_METHOD) config.bindForeignMethodFn = wrengoBindForeignMethodFn;
+	if (callbacks & WRENGO_CALLBACK_REALLOCATE) config.reallocateFn = wrengoReallocateFn;
+	if (callbacks & WRENGO_CALLBACK_RESOLVE_MODULE) config.resolveModuleFn = wrengoResolveModuleFn;
+	if (callbacks & WRENGO_CALLBACK_BIND_FOREIGN_CLASS) config.bindForeignClassFn = wrengoBindForeignClassFn;
+
+	// The VM's ID, which the callbacks use to find the Go side of the VM.
+	config.userData = (void*)id;
+
+	return wrenNewVM(&config);
+
+}
@@ -0,0 +1,499 @@
+//go:build cgo && wrengo_static
+
+package wrengo
+
+//go:generate sh internal/wren/generate.sh
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/internal/wren -DWREN_OPT_META=1 -DWREN_OPT_RANDOM=1
+#cgo LDFLAGS: -lm
+
+#include <stdlib.h>
+#include <stdbool.h>
+#include <stdint.h>
+
+#if !__has_include("wren.h")
+#error "wrengo_static needs the Wren 0.4.0 sources in internal/wren; run go generate -tags wrengo_static (see internal/wren/README.md)"
+#endif
+
+#include "wren.h"
+
+WrenVM* wrengoNewVM(size_t initialHeapSize, size_t minHeapSize, int heapGrowthPercent, int callbacks, uintptr_t id);
+*/
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// These flags tell wrengoNewVM() which of the Go callbacks to hook up to the VM's configuration.
+const (
+	cgoCallbackWrite = 1 << iota
+	cgoCallbackError
+	cgoCallbackLoadModule
+	cgoCallbackBindForeignMethod
+	cgoCallbackReallocate
+	cgoCallbackResolveModule
+	cgoCallbackBindForeignClass
+)
+
+// cgoForeignTrampolines is the number of C functions wrengo can hand to Wren as foreign methods for each VM;
+// it must match WRENGO_TRAMPOLINES in backend_cgo.c.
+const cgoForeignTrampolines = 1000
+
+// cgoForeignHeaderSize is the size of the header the backend adds before the data of each foreign object, which
+// holds the ID of the object's VM; it keeps the data aligned as malloc() would.
+const cgoForeignHeaderSize = 16
+
+// cgoBackend calls into a copy of Wren that's statically linked into the executable using cgo.
+// The Wren sources are compiled from the amalgamated wren.c and wren.h in internal/wren.
+type cgoBackend struct{}
+
+// cgoVM holds the Go side of a VM created by the cgo backend.
+type cgoVM struct {
+	config *BackendConfig
+	// The functions called through the VM's trampolines: its foreign methods, and the allocators of its foreign
+	// classes.
+	foreignMethods []func(vm uintptr)
+}
+
+// cgoVMs maps the ID each VM is created with to its Go side. The ID is stored as the VM's user data, as Wren
+// allocates memory through the reallocate callback before the VM's pointer is known.
+var cgoVMs = map[uintptr]*cgoVM{}
+var cgoVMsLock sync.Mutex
+var cgoNextVMID uintptr
+
+// LoadStatic returns a Library that calls into the copy of Wren statically linked into the executable.
+// It's only available when building with cgo and the wrengo_static build tag, in which case there's no
+// shared library to ship or load.
+func LoadStatic() (*Library, error) {
+	return LoadBackend(cgoBackend{})
+}
+
+// InitStatic initializes the Wren-Go bindings using the statically linked copy of Wren (see LoadStatic()).
+func InitStatic() error {
+
+	lib, err := LoadStatic()
+	if err != nil {
+		return err
+	}
+
+	defaultLibrary.Store(lib)
+	return nil
+
+}
+
+// wrenVM converts the VM handle back to the WrenVM pointer it was made from.
+func wrenVM(vm uintptr) *C.WrenVM {
+	return *(**C.WrenVM)(unsafe.Pointer(&vm))
+}
+
+func cgoLookupVM(vm *C.WrenVM) *cgoVM {
+	return cgoLookupID(uintptr(C.wrenGetUserData(vm)))
+}
+
+func cgoLookupID(id uintptr) *cgoVM {
+	cgoVMsLock.Lock()
+	defer cgoVMsLock.Unlock()
+	return cgoVMs[id]
+}
+
+//export wrengoReallocate
+func wrengoReallocate(id C.uintptr_t, memory C.uintptr_t, newSize C.size_t) C.uintptr_t {
+	v := cgoLookupID(uintptr(id))
+	return C.uintptr_t(v.config.Reallocate(uintptr(memory), uintptr(newSize)))
+}
+
+//export wrengoWrite
+func wrengoWrite(vm *C.WrenVM, text *C.char) {
+	if v := cgoLookupVM(vm); v != nil {
+		v.config.Write(uintptr(unsafe.Pointer(vm)), C.GoString(text))
+	}
+}
+
+//export wrengoError
+func wrengoError(vm *C.WrenVM, errorType C.int, module *C.char, line C.int, message *C.char) {
+	if v := cgoLookupVM(vm); v != nil {
+		v.config.Error(uintptr(unsafe.Pointer(vm)), int(errorType), C.GoString(module), int(line), C.GoString(message))
+	}
+}
+
+// wrengoResolveModule returns the canonical name of the imported module. Unless that's the name Wren passed in,
+// it's a copy allocated with the VM's allocator, as Wren frees it.
+//
+//export wrengoResolveModule
+func wrengoResolveModule(vm *C.WrenVM, importer, name *C.char) *C.char {
+
+	v := cgoLookupVM(vm)
+	if v == nil {
+		return name
+	}
+
+	resolved := v.config.ResolveModule(uintptr(unsafe.Pointer(vm)), C.GoString(importer), C.GoString(name))
+	if resolved == C.GoString(name) {
+		return name
+	}
+
+	if v.config.Reallocate == nil {
+		return C.CString(resolved)
+	}
+
+	memory := v.config.Reallocate(0, uintptr(len(resolved)+1))
+	if memory == 0 {
+		return nil
+	}
+	buffer := unsafe.Slice((*byte)(cPointer(memory)), len(resolved)+1)
+	copy(buffer, resolved)
+	buffer[len(resolved)] = 0
+	return (*C.char)(cPointer(memory))
+
+}
+
+// wrengoLoadModule returns a copy of the module's source allocated with malloc(); it's freed by the
+// WrenLoadModuleResult's onComplete callback once Wren is done with it.
+//
+//export wrengoLoadModule
+func wrengoLoadModule(vm *C.WrenVM, name *C.char) *C.char {
+
+	v := cgoLookupVM(vm)
+	if v == nil {
+		return nil
+	}
+
+	src := v.config.LoadModule(uintptr(unsafe.Pointer(vm)), C.GoString(name))
+	if src == nil {
+		return nil
+	}
+
+	return C.CString(string(src))
+
+}
+
+// wrengoBindForeignMethod returns the index of the trampoline Wren should call for the foreign method,
+// or -1 if there's no Go function for it.
+//
+//export wrengoBindForeignMethod
+func wrengoBindForeignMethod(vm *C.WrenVM, module, className *C.char, isStatic C.bool, signature *C.char) C.int {
+
+	v := cgoLookupVM(vm)
+	if v == nil {
+		return -1
+	}
+
+	fn := v.config.BindForeignMethod(uintptr(unsafe.Pointer(vm)), C.GoString(module), C.GoString(className), bool(isStatic), C.GoString(signature))
+	return v.addTrampoline(fn)
+
+}
+
+// wrengoBindForeignClass returns the index of the trampoline Wren should call to allocate instances of the foreign
+// class, or -1 if there's no Go function for it.
+//
+//export wrengoBindForeignClass
+func wrengoBindForeignClass(vm *C.WrenVM, module, className *C.char) C.int {
+
+	v := cgoLookupVM(vm)
+	if v == nil {
+		return -1
+	}
+
+	allocate := v.config.BindForeignClass(uintptr(unsafe.Pointer(vm)), C.GoString(module), C.GoString(className))
+	return v.addTrampoline(allocate)
+
+}
+
+// addTrampoline adds the function to those called through the VM's trampolines, returning its index, or -1 if
+// there's no function or no trampolines left.
+func (v *cgoVM) addTrampoline(fn func(vm uintptr)) C.int {
+
+	if fn == nil {
+		return -1
+	}
+
+	cgoVMsLock.Lock()
+	defer cgoVMsLock.Unlock()
+
+	if len(v.foreignMethods) >= cgoForeignTrampolines {
+		return -1
+	}
+
+	v.foreignMethods = append(v.foreignMethods, fn)
+	return C.int(len(v.foreignMethods) - 1)
+
+}
+
+// wrengoFinalize is the finalizer of every foreign class bound by the backend; it finds the object's VM from the
+// header before the object's data (see SetSlotNewForeign()).
+//
+//export wrengoFinalize
+func wrengoFinalize(data C.uintptr_t) {
+	if v := cgoLookupID(*(*uintptr)(cPointer(uintptr(data)))); v != nil {
+		v.config.FinalizeForeign(uintptr(data) + cgoForeignHeaderSize)
+	}
+}
+
+//export wrengoCallForeign
+func wrengoCallForeign(vm *C.WrenVM, index C.int) {
+
+	v := cgoLookupVM(vm)
+	if v == nil {
+		return
+	}
+
+	cgoVMsLock.Lock()
+	fn := v.foreignMethods[index]
+	cgoVMsLock.Unlock()
+
+	fn(uintptr(unsafe.Pointer(vm)))
+
+}
+
+func (cgoBackend) VersionNumber() int {
+	return int(C.wrenGetVersionNumber())
+}
+
+func (cgoBackend) HasFunction(name string) bool {
+	// The vendored sources are stock Wren, so every function is available.
+	return true
+}
+
+func (cgoBackend) NewVM(config *BackendConfig) uintptr {
+
+	callbacks := 0
+
+	if config.Write != nil {
+		callbacks |= cgoCallbackWrite
+	}
+	if config.Error != nil {
+		callbacks |= cgoCallbackError
+	}
+	if config.LoadModule != nil {
+		callbacks |= cgoCallbackLoadModule
+	}
+	if config.BindForeignMethod != nil {
+		callbacks |= cgoCallbackBindForeignMethod
+	}
+	if config.Reallocate != nil {
+		callbacks |= cgoCallbackReallocate
+	}
+	if config.ResolveModule != nil {
+		callbacks |= cgoCallbackResolveModule
+	}
+	if config.BindForeignClass != nil {
+		callbacks |= cgoCallbackBindForeignClass
+	}
+
+	cgoVMsLock.Lock()
+	cgoNextVMID++
+	id := cgoNextVMID
+	cgoVMs[id] = &cgoVM{config: config}
+	cgoVMsLock.Unlock()
+
+	vm := C.wrengoNewVM(C.size_t(config.InitialHeapSize), C.size_t(config.MinHeapSize), C.int(config.HeapGrowthPercent), C.int(callbacks), C.uintptr_t(id))
+
+	return uintptr(unsafe.Pointer(vm))
+
+}
+
+func (cgoBackend) FreeVM(vm uintptr) {
+
+	id := uintptr(C.wrenGetUserData(wrenVM(vm)))
+
+	C.wrenFreeVM(wrenVM(vm))
+
+	cgoVMsLock.Lock()
+	delete(cgoVMs, id)
+	cgoVMsLock.Unlock()
+
+}
+
+func (cgoBackend) Reallocate(memory uintptr, newSize uintptr) uintptr {
+	if newSize == 0 {
+		C.free(*(*unsafe.Pointer)(unsafe.Pointer(&memory)))
+		return 0
+	}
+	return uintptr(C.realloc(*(*unsafe.Pointer)(unsafe.Pointer(&memory)), C.size_t(newSize)))
+}
+
+func (cgoBackend) Interpret(vm uintptr, module, source string) int {
+	cModule := C.CString(module)
+	defer C.free(unsafe.Pointer(cModule))
+	cSource := C.CString(source)
+	defer C.free(unsafe.Pointer(cSource))
+	return int(C.wrenInterpret(wrenVM(vm), cModule, cSource))
+}
+
+func (cgoBackend) EnsureSlots(vm uintptr, slotCount int) {
+	C.wrenEnsureSlots(wrenVM(vm), C.int(slotCount))
+}
+
+func (cgoBackend) GetSlotCount(vm uintptr) int {
+	return int(C.wrenGetSlotCount(wrenVM(vm)))
+}
+
+func (cgoBackend) GetSlotType(vm uintptr, slot int) int {
+	return int(C.wrenGetSlotType(wrenVM(vm), C.int(slot)))
+}
+
+func (cgoBackend) SetSlotBool(vm uintptr, slot int, value bool) {
+	C.wrenSetSlotBool(wrenVM(vm), C.int(slot), C.bool(value))
+}
+
+func (cgoBackend) SetSlotDouble(vm uintptr, slot int, value float64) {
+	C.wrenSetSlotDouble(wrenVM(vm), C.int(slot), C.double(value))
+}
+
+func (cgoBackend) SetSlotNull(vm uintptr, slot int) {
+	C.wrenSetSlotNull(wrenVM(vm), C.int(slot))
+}
+
+func (cgoBackend) SetSlotBytes(vm uintptr, slot int, bytes []byte) {
+	var ptr *C.char
+	if len(bytes) > 0 {
+		ptr = (*C.char)(unsafe.Pointer(&bytes[0]))
+	}
+	C.wrenSetSlotBytes(wrenVM(vm), C.int(slot), ptr, C.size_t(len(bytes)))
+}
+
+func (cgoBackend) SetSlotString(vm uintptr, slot int, text string) {
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+	C.wrenSetSlotString(wrenVM(vm), C.int(slot), cText)
+}
+
+func (cgoBackend) GetSlotBool(vm uintptr, slot int) bool {
+	return bool(C.wrenGetSlotBool(wrenVM(vm), C.int(slot)))
+}
+
+func (cgoBackend) GetSlotDouble(vm uintptr, slot int) float64 {
+	return float64(C.wrenGetSlotDouble(wrenVM(vm), C.int(slot)))
+}
+
+func (cgoBackend) GetSlotString(vm uintptr, slot int) string {
+	return C.GoString(C.wrenGetSlotString(wrenVM(vm), C.int(slot)))
+}
+
+func (cgoBackend) GetSlotBytes(vm uintptr, slot int) []byte {
+	length := C.int(0)
+	ptr := C.wrenGetSlotBytes(wrenVM(vm), C.int(slot), &length)
+	return C.GoBytes(unsafe.Pointer(ptr), length)
+}
+
+func (cgoBackend) SetSlotNewList(vm uintptr, slot int) {
+	C.wrenSetSlotNewList(wrenVM(vm), C.int(slot))
+}
+
+func (cgoBackend) GetListCount(vm uintptr, slot int) int {
+	return int(C.wrenGetListCount(wrenVM(vm), C.int(slot)))
+}
+
+func (cgoBackend) GetListElement(vm uintptr, listSlot, index, elementSlot int) {
+	C.wrenGetListElement(wrenVM(vm), C.int(listSlot), C.int(index), C.int(elementSlot))
+}
+
+func (cgoBackend) SetListElement(vm uintptr, listSlot, index, elementSlot int) {
+	C.wrenSetListElement(wrenVM(vm), C.int(listSlot), C.int(index), C.int(elementSlot))
+}
+
+func (cgoBackend) InsertInList(vm uintptr, listSlot, index, elementSlot int) {
+	C.wrenInsertInList(wrenVM(vm), C.int(listSlot), C.int(index), C.int(elementSlot))
+}
+
+func (cgoBackend) SetSlotNewMap(vm uintptr, slot int) {
+	C.wrenSetSlotNewMap(wrenVM(vm), C.int(slot))
+}
+
+func (cgoBackend) GetMapCount(vm uintptr, slot int) int {
+	return int(C.wrenGetMapCount(wrenVM(vm), C.int(slot)))
+}
+
+func (cgoBackend) GetMapContainsKey(vm uintptr, mapSlot, keySlot int) bool {
+	return bool(C.wrenGetMapContainsKey(wrenVM(vm), C.int(mapSlot), C.int(keySlot)))
+}
+
+func (cgoBackend) GetMapKey(vm uintptr, mapSlot, index, keySlot int) {
+	C.wrenGetMapKey(wrenVM(vm), C.int(mapSlot), C.int(index), C.int(keySlot))
+}
+
+func (cgoBackend) GetMapValue(vm uintptr, mapSlot, keySlot, valueSlot int) {
+	C.wrenGetMapValue(wrenVM(vm), C.int(mapSlot), C.int(keySlot), C.int(valueSlot))
+}
+
+func (cgoBackend) SetMapValue(vm uintptr, mapSlot, keySlot, valueSlot int) {
+	C.wrenSetMapValue(wrenVM(vm), C.int(mapSlot), C.int(keySlot), C.int(valueSlot))
+}
+
+func (cgoBackend) RemoveMapValue(vm uintptr, mapSlot, keySlot, removedValueSlot int) {
+	C.wrenRemoveMapValue(wrenVM(vm), C.int(mapSlot), C.int(keySlot), C.int(removedValueSlot))
+}
+
+func (cgoBackend) MakeCallHandle(vm uintptr, signature string) uintptr {
+	cSignature := C.CString(signature)
+	defer C.free(unsafe.Pointer(cSignature))
+	return uintptr(unsafe.Pointer(C.wrenMakeCallHandle(wrenVM(vm), cSignature)))
+}
+
+func (cgoBackend) Call(vm uintptr, method uintptr) int {
+	return int(C.wrenCall(wrenVM(vm), wrenHandle(method)))
+}
+
+func (cgoBackend) GetSlotHandle(vm uintptr, slot int) uintptr {
+	return uintptr(unsafe.Pointer(C.wrenGetSlotHandle(wrenVM(vm), C.int(slot))))
+}
+
+func (cgoBackend) SetSlotHandle(vm uintptr, slot int, handle uintptr) {
+	C.wrenSetSlotHandle(wrenVM(vm), C.int(slot), wrenHandle(handle))
+}
+
+func (cgoBackend) ReleaseHandle(vm uintptr, handle uintptr) {
+	C.wrenReleaseHandle(wrenVM(vm), wrenHandle(handle))
+}
+
+func (cgoBackend) GetVariable(vm uintptr, module, name string, slot int) {
+	cModule := C.CString(module)
+	defer C.free(unsafe.Pointer(cModule))
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	C.wrenGetVariable(wrenVM(vm), cModule, cName, C.int(slot))
+}
+
+func (cgoBackend) HasVariable(vm uintptr, module, name string) bool {
+	cModule := C.CString(module)
+	defer C.free(unsafe.Pointer(cModule))
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	return bool(C.wrenHasVariable(wrenVM(vm), cModule, cName))
+}
+
+func (cgoBackend) HasModule(vm uintptr, module string) bool {
+	cModule := C.CString(module)
+	defer C.free(unsafe.Pointer(cModule))
+	return bool(C.wrenHasModule(wrenVM(vm), cModule))
+}
+
+func (cgoBackend) AbortFiber(vm uintptr, slot int) {
+	C.wrenAbortFiber(wrenVM(vm), C.int(slot))
+}
+
+func (cgoBackend) CollectGarbage(vm uintptr) {
+	C.wrenCollectGarbage(wrenVM(vm))
+}
+
+func (cgoBackend) SetSlotNewForeign(vm uintptr, slot, classSlot int, size uintptr) uintptr {
+	data := uintptr(C.wrenSetSlotNewForeign(wrenVM(vm), C.int(slot), C.int(classSlot), C.size_t(size+cgoForeignHeaderSize)))
+	*(*uintptr)(cPointer(data)) = uintptr(C.wrenGetUserData(wrenVM(vm)))
+	return data + cgoForeignHeaderSize
+}
+
+func (cgoBackend) GetSlotForeign(vm uintptr, slot int) uintptr {
+	return uintptr(C.wrenGetSlotForeign(wrenVM(vm), C.int(slot))) + cgoForeignHeaderSize
+}
+
+func (cgoBackend) Close() error {
+	return nil
+}
+
+// wrenHandle converts a handle back to the WrenHandle pointer it was made from.
+func wrenHandle(handle uintptr) *C.WrenHandle {
+	return *(**C.WrenHandle)(unsafe.Pointer(&handle))
+}
@@ -0,0 +1,812 @@
+package wrengo
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// FakeBackend is an in-memory, pure-Go stand-in for Wren that implements the Backend interface. It keeps slots,
+// lists, maps, module variables and handles the way Wren does, so code that converts values, dispatches foreign
+// methods, or calls into scripts can be tested without loading the Wren library:
+//
+//	fake := wrengo.NewFakeBackend()
+//	lib, _ := wrengo.LoadBackend(fake)
+//	vm := lib.NewVM(lib.NewConfig().WithForeignMethodResolver(resolver))
+//	result, err := fake.CallForeign(vm, "main", "Game", "add(_,_)", true, 1, 2)
+//
+// FakeBackend doesn't compile or run Wren code; Interpret() only registers the module and calls OnInterpret, if
+// it's set. The module variables and methods that scripts would define are set up from Go instead, with
+// SetVariable() and SetMethod(), and instances of foreign classes are created with Construct().
+//
+// Misusing the API (reading a slot that doesn't exist, reading a number as a string, releasing a handle twice, and
+// so on) panics, where Wren would fail an assertion or corrupt memory.
+type FakeBackend struct {
+	// OnInterpret, if set, is called when a VM runs source code. Returning an error reports it as a runtime error.
+	OnInterpret func(vm *VM, module, source string) error
+
+	mu     sync.Mutex
+	vms    map[uintptr]*fakeVM
+	nextVM uintptr
+}
+
+// FakeMethod is a method defined on a FakeBackend module variable with SetMethod(). It's called with the arguments
+// the method was called with, converted to Go values, and returns the method's result, or an error to abort the
+// fiber with.
+type FakeMethod func(args []any) (any, error)
+
+type fakeVM struct {
+	config *BackendConfig
+
+	slots      []any
+	modules    map[string]map[string]any
+	handles    map[uintptr]any
+	nextHandle uintptr
+	foreign    map[string]func(vm uintptr)
+	allocators map[string]func(vm uintptr)
+	objects    []*FakeForeign
+	aborted    any
+}
+
+// FakeForeign is an instance of a foreign class, created with FakeBackend.Construct(). It can be passed to foreign
+// methods as an argument, or called as a receiver with FakeBackend.CallMethod().
+type FakeForeign struct {
+	module    string
+	className string
+	data      []uint64
+}
+
+// fakeClass is a foreign class, as held in slot 0 while its allocator runs.
+type fakeClass struct {
+	module string
+	name   string
+}
+
+type fakeList struct {
+	elements []any
+}
+
+type fakeMap struct {
+	keys   []any
+	values map[any]any
+}
+
+type fakeObject struct {
+	name    string
+	methods map[string]FakeMethod
+}
+
+type fakeCallHandle struct {
+	signature string
+}
+
+// NewFakeBackend creates a new FakeBackend; pass it to LoadBackend() to create VMs from it.
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{
+		vms: map[uintptr]*fakeVM{},
+	}
+}
+
+// SetVariable sets the module variable of the given name to the value, creating the module if it doesn't exist yet.
+// The value can be any type CallHandle.Call() accepts as an argument.
+func (f *FakeBackend) SetVariable(vm *VM, module, name string, value any) error {
+
+	unlock, err := vm.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if vm.freed {
+		return ErrVMFreed
+	}
+
+	v, ok := goToFake(value)
+	if !ok {
+		return fmt.Errorf("error: value ( %v ) cannot be converted", value)
+	}
+
+	f.vm(vm.handle).module(module)[name] = v
+	return nil
+
+}
+
+// SetMethod defines a method with the given signature (e.g. "call(_)" or "walk(_,_)") on the module variable
+// object, so that CallHandles to it can be called. If the variable doesn't exist or holds a plain value, it's
+// replaced with an object.
+func (f *FakeBackend) SetMethod(vm *VM, module, object, signature string, method FakeMethod) {
+
+	unlock, err := vm.lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	variables := f.vm(vm.handle).module(module)
+
+	obj, ok := variables[object].(*fakeObject)
+	if !ok {
+		obj = &fakeObject{name: object, methods: map[string]FakeMethod{}}
+		variables[object] = obj
+	}
+
+	obj.methods[strings.ReplaceAll(signature, " ", "")] = method
+
+}
+
+// CallForeign calls a foreign method the way Wren would when a script calls it: the method is bound through the
+// VM's configuration (see Config.WithForeignMethodResolver()), the receiver and arguments are put in the slots,
+// and the value left in slot 0 is returned. An error is returned if the method couldn't be bound, or if it
+// aborted the fiber.
+func (f *FakeBackend) CallForeign(vm *VM, module, className, signature string, isStatic bool, args ...any) (any, error) {
+	return f.callForeign(vm, module, className, signature, isStatic, &fakeObject{name: className}, args)
+}
+
+// CallMethod calls a foreign instance method on an instance of a foreign class created with Construct(), like
+// CallForeign() does for other receivers.
+func (f *FakeBackend) CallMethod(vm *VM, receiver *FakeForeign, signature string, args ...any) (any, error) {
+	return f.callForeign(vm, receiver.module, receiver.className, signature, false, receiver, args)
+}
+
+// Construct creates an instance of a foreign class the way Wren would when a script constructs one: the class is
+// bound through the VM's configuration (see Config.WithForeignClassResolver()), and its allocator is called with
+// the constructor's arguments. An error is returned if the class couldn't be bound, or if its allocator aborted
+// the fiber.
+//
+// The instance is finalized when the VM is freed, or earlier with Collect().
+func (f *FakeBackend) Construct(vm *VM, module, className string, args ...any) (*FakeForeign, error) {
+
+	unlock, err := vm.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if vm.freed {
+		return nil, ErrVMFreed
+	}
+
+	v := f.vm(vm.handle)
+	key := module + " " + className
+
+	allocate, ok := v.allocators[key]
+	if !ok {
+		if v.config.BindForeignClass != nil {
+			allocate = v.config.BindForeignClass(vm.handle, module, className)
+		}
+		if allocate == nil {
+			return nil, fmt.Errorf("error: could not find foreign class %s in module '%s'", className, module)
+		}
+		v.allocators[key] = allocate
+	}
+
+	callerSlots := v.slots
+	defer func() { v.slots = callerSlots }()
+
+	v.slots = make([]any, len(args)+1)
+	v.slots[0] = &fakeClass{module: module, name: className}
+
+	for i, arg := range args {
+		value, ok := goToFake(arg)
+		if !ok {
+			return nil, fmt.Errorf("error converting arguments; argument #%d, ( %v ) cannot be converted", i, arg)
+		}
+		v.slots[i+1] = value
+	}
+
+	v.aborted = nil
+
+	allocate(vm.handle)
+
+	if v.aborted != nil {
+		err := v.aborted
+		v.aborted = nil
+		return nil, fmt.Errorf("%v", fakeToGo(err))
+	}
+
+	object, ok := v.slots[0].(*FakeForeign)
+	if !ok {
+		return nil, fmt.Errorf("error: the allocator of foreign class %s didn't create an instance", className)
+	}
+
+	return object, nil
+
+}
+
+// Collect finalizes the instance of a foreign class, as Wren does once its garbage collector frees it.
+func (f *FakeBackend) Collect(vm *VM, object *FakeForeign) {
+	unlock, err := vm.lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+	v := f.vm(vm.handle)
+	for i, o := range v.objects {
+		if o == object {
+			v.objects = append(v.objects[:i], v.objects[i+1:]...)
+			v.finalize(object)
+			return
+		}
+	}
+	panic("wrengo: fake backend: foreign object already collected")
+}
+
+func (v *fakeVM) finalize(object *FakeForeign) {
+	if v.config.FinalizeForeign != nil {
+		v.config.FinalizeForeign(uintptr(unsafe.Pointer(&object.data[0])))
+	}
+}
+
+func (f *FakeBackend) callForeign(vm *VM, module, className, signature string, isStatic bool, receiver any, args []any) (any, error) {
+
+	unlock, err := vm.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if vm.freed {
+		return nil, ErrVMFreed
+	}
+
+	v := f.vm(vm.handle)
+	signature = strings.ReplaceAll(signature, " ", "")
+
+	if argCount := strings.Count(signature, "_"); len(args) != argCount {
+		return nil, fmt.Errorf("error: '%s' takes %d arguments, but %d were provided", signature, argCount, len(args))
+	}
+
+	key := fmt.Sprintf("%s %s %t %s", module, className, isStatic, signature)
+
+	fn, ok := v.foreign[key]
+	if !ok {
+		if v.config.BindForeignMethod != nil {
+			fn = v.config.BindForeignMethod(vm.handle, module, className, isStatic, signature)
+		}
+		if fn == nil {
+			return nil, fmt.Errorf("error: could not find foreign method '%s' for class %s in module '%s'", signature, className, module)
+		}
+		v.foreign[key] = fn
+	}
+
+	// Foreign methods get their own slots, holding only the receiver and the arguments
+	callerSlots := v.slots
+	defer func() { v.slots = callerSlots }()
+
+	v.slots = make([]any, len(args)+1)
+	v.slots[0] = receiver
+
+	for i, arg := range args {
+		value, ok := goToFake(arg)
+		if !ok {
+			return nil, fmt.Errorf("error converting arguments; argument #%d, ( %v ) cannot be converted", i, arg)
+		}
+		v.slots[i+1] = value
+	}
+
+	v.aborted = nil
+
+	fn(vm.handle)
+
+	if v.aborted != nil {
+		err := v.aborted
+		v.aborted = nil
+		return nil, fmt.Errorf("%v", fakeToGo(err))
+	}
+
+	return fakeToGo(v.slots[0]), nil
+
+}
+
+func (f *FakeBackend) vm(handle uintptr) *fakeVM {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.vms[handle]
+	if !ok {
+		panic(fmt.Sprintf("wrengo: fake backend: unknown VM %d", handle))
+	}
+	return v
+}
+
+func (v *fakeVM) module(name string) map[string]any {
+	variables, ok := v.modules[name]
+	if !ok {
+		variables = map[string]any{}
+		v.modules[name] = variables
+	}
+	return variables
+}
+
+func (v *fakeVM) slot(slot int) *any {
+	if slot < 0 || slot >= len(v.slots) {
+		panic(fmt.Sprintf("wrengo: fake backend: slot %d out of range; there are %d slots", slot, len(v.slots)))
+	}
+	return &v.slots[slot]
+}
+
+func (v *fakeVM) list(slot int) *fakeList {
+	list, ok := (*v.slot(slot)).(*fakeList)
+	if !ok {
+		panic(fmt.Sprintf("wrengo: fake backend: slot %d must hold a list", slot))
+	}
+	return list
+}
+
+func (v *fakeVM) mapping(slot int) *fakeMap {
+	mapping, ok := (*v.slot(slot)).(*fakeMap)
+	if !ok {
+		panic(fmt.Sprintf("wrengo: fake backend: slot %d must hold a map", slot))
+	}
+	return mapping
+}
+
+func (v *fakeVM) mapKey(slot int) any {
+	key := *v.slot(slot)
+	switch key.(type) {
+	case nil, bool, float64, string:
+		return key
+	}
+	panic(fmt.Sprintf("wrengo: fake backend: slot %d must hold a value type to be used as a map key", slot))
+}
+
+func (v *fakeVM) addHandle(value any) uintptr {
+	v.nextHandle++
+	v.handles[v.nextHandle] = value
+	return v.nextHandle
+}
+
+func (v *fakeVM) handle(handle uintptr) any {
+	value, ok := v.handles[handle]
+	if !ok {
+		panic(fmt.Sprintf("wrengo: fake backend: unknown or released handle %d", handle))
+	}
+	return value
+}
+
+// runtimeError reports the message through the Error callback, and returns the WREN_RESULT_RUNTIME_ERROR result.
+func (v *fakeVM) runtimeError(vm uintptr, message string) int {
+	if v.config.Error != nil {
+		v.config.Error(vm, 1, "", 0, message)
+	}
+	return 2
+}
+
+// listIndex resolves a (possibly negative) list index the way Wren does, panicking if it's out of bounds.
+func listIndex(index, count int) int {
+	if index < 0 {
+		index += count
+	}
+	if index < 0 || index >= count {
+		panic(fmt.Sprintf("wrengo: fake backend: list index %d out of bounds", index))
+	}
+	return index
+}
+
+// goToFake converts a Go value to the FakeBackend's representation of the Wren value, returning false if it
+// can't be converted.
+func goToFake(value any) (any, bool) {
+
+	switch v := value.(type) {
+	case nil, bool, float64, string, *FakeForeign:
+		return v, true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case []byte:
+		return string(v), true
+	case []any:
+		list := &fakeList{}
+		for _, e := range v {
+			element, ok := goToFake(e)
+			if !ok {
+				return nil, false
+			}
+			list.elements = append(list.elements, element)
+		}
+		return list, true
+	case map[any]any:
+		mapping := &fakeMap{values: map[any]any{}}
+		for k, e := range v {
+			key, ok := goToFake(k)
+			if !ok {
+				return nil, false
+			}
+			element, ok := goToFake(e)
+			if !ok {
+				return nil, false
+			}
+			if _, exists := mapping.values[key]; !exists {
+				mapping.keys = append(mapping.keys, key)
+			}
+			mapping.values[key] = element
+		}
+		return mapping, true
+	}
+
+	return nil, false
+
+}
+
+// fakeToGo converts a FakeBackend value back to a Go value; objects convert to nil.
+func fakeToGo(value any) any {
+
+	switch v := value.(type) {
+	case *fakeList:
+		list := []any{}
+		for _, e := range v.elements {
+			list = append(list, fakeToGo(e))
+		}
+		return list
+	case *fakeMap:
+		mapping := map[any]any{}
+		for _, k := range v.keys {
+			mapping[k] = fakeToGo(v.values[k])
+		}
+		return mapping
+	case *fakeObject:
+		return nil
+	}
+
+	return value
+
+}
+
+func (f *FakeBackend) VersionNumber() int {
+	return 4000
+}
+
+func (f *FakeBackend) HasFunction(name string) bool {
+	return true
+}
+
+func (f *FakeBackend) NewVM(config *BackendConfig) uintptr {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextVM++
+	f.vms[f.nextVM] = &fakeVM{
+		config:     config,
+		modules:    map[string]map[string]any{},
+		handles:    map[uintptr]any{},
+		foreign:    map[string]func(vm uintptr){},
+		allocators: map[string]func(vm uintptr){},
+	}
+	return f.nextVM
+}
+
+func (f *FakeBackend) FreeVM(vm uintptr) {
+	v := f.vm(vm)
+	// Like Wren, finalize the foreign objects that are left
+	for _, object := range v.objects {
+		v.finalize(object)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.vms, vm)
+}
+
+func (f *FakeBackend) Interpret(vm uintptr, module, source string) int {
+
+	v := f.vm(vm)
+	v.slots = nil
+	v.module(module)
+
+	if f.OnInterpret != nil {
+		if err := f.OnInterpret(v.config.vm.Value(), module, source); err != nil {
+			return v.runtimeError(vm, err.Error())
+		}
+	}
+
+	return 0
+
+}
+
+// Reallocate panics; the fake backend doesn't allocate memory for its VMs, so it never needs to.
+func (f *FakeBackend) Reallocate(memory uintptr, newSize uintptr) uintptr {
+	panic("wrengo: fake backend: Reallocate() isn't supported")
+}
+
+func (f *FakeBackend) EnsureSlots(vm uintptr, slotCount int) {
+	v := f.vm(vm)
+	for len(v.slots) < slotCount {
+		v.slots = append(v.slots, nil)
+	}
+}
+
+func (f *FakeBackend) GetSlotCount(vm uintptr) int {
+	return len(f.vm(vm).slots)
+}
+
+func (f *FakeBackend) GetSlotType(vm uintptr, slot int) int {
+	switch (*f.vm(vm).slot(slot)).(type) {
+	case bool:
+		return int(SlotTypeBool)
+	case float64:
+		return int(SlotTypeNumber)
+	case *fakeList:
+		return int(SlotTypeList)
+	case *fakeMap:
+		return int(SlotTypeMap)
+	case nil:
+		return int(SlotTypeNull)
+	case string:
+		return int(SlotTypeString)
+	case *FakeForeign:
+		return int(SlotTypeForeign)
+	}
+	return int(SlotTypeUnknown)
+}
+
+func (f *FakeBackend) SetSlotBool(vm uintptr, slot int, value bool) {
+	*f.vm(vm).slot(slot) = value
+}
+
+func (f *FakeBackend) SetSlotDouble(vm uintptr, slot int, value float64) {
+	*f.vm(vm).slot(slot) = value
+}
+
+func (f *FakeBackend) SetSlotNull(vm uintptr, slot int) {
+	*f.vm(vm).slot(slot) = nil
+}
+
+func (f *FakeBackend) SetSlotBytes(vm uintptr, slot int, bytes []byte) {
+	*f.vm(vm).slot(slot) = string(bytes)
+}
+
+func (f *FakeBackend) SetSlotString(vm uintptr, slot int, text string) {
+	*f.vm(vm).slot(slot) = text
+}
+
+func (f *FakeBackend) GetSlotBool(vm uintptr, slot int) bool {
+	value, ok := (*f.vm(vm).slot(slot)).(bool)
+	if !ok {
+		panic(fmt.Sprintf("wrengo: fake backend: slot %d must hold a bool", slot))
+	}
+	return value
+}
+
+func (f *FakeBackend) GetSlotDouble(vm uintptr, slot int) float64 {
+	value, ok := (*f.vm(vm).slot(slot)).(float64)
+	if !ok {
+		panic(fmt.Sprintf("wrengo: fake backend: slot %d must hold a number", slot))
+	}
+	return value
+}
+
+func (f *FakeBackend) GetSlotString(vm uintptr, slot int) string {
+	value, ok := (*f.vm(vm).slot(slot)).(string)
+	if !ok {
+		panic(fmt.Sprintf("wrengo: fake backend: slot %d must hold a string", slot))
+	}
+	return value
+}
+
+func (f *FakeBackend) GetSlotBytes(vm uintptr, slot int) []byte {
+	return []byte(f.GetSlotString(vm, slot))
+}
+
+func (f *FakeBackend) SetSlotNewList(vm uintptr, slot int) {
+	*f.vm(vm).slot(slot) = &fakeList{}
+}
+
+func (f *FakeBackend) GetListCount(vm uintptr, slot int) int {
+	return len(f.vm(vm).list(slot).elements)
+}
+
+func (f *FakeBackend) GetListElement(vm uintptr, listSlot, index, elementSlot int) {
+	v := f.vm(vm)
+	list := v.list(listSlot)
+	*v.slot(elementSlot) = list.elements[listIndex(index, len(list.elements))]
+}
+
+func (f *FakeBackend) SetListElement(vm uintptr, listSlot, index, elementSlot int) {
+	v := f.vm(vm)
+	list := v.list(listSlot)
+	list.elements[listIndex(index, len(list.elements))] = *v.slot(elementSlot)
+}
+
+func (f *FakeBackend) InsertInList(vm uintptr, listSlot, index, elementSlot int) {
+	v := f.vm(vm)
+	list := v.list(listSlot)
+
+	// Negative indices count from the end, with -1 appending
+	if index < 0 {
+		index += len(list.elements) + 1
+	}
+	if index < 0 || index > len(list.elements) {
+		panic(fmt.Sprintf("wrengo: fake backend: list index %d out of bounds", index))
+	}
+
+	list.elements = append(list.elements, nil)
+	copy(list.elements[index+1:], list.elements[index:])
+	list.elements[index] = *v.slot(elementSlot)
+}
+
+func (f *FakeBackend) SetSlotNewMap(vm uintptr, slot int) {
+	*f.vm(vm).slot(slot) = &fakeMap{values: map[any]any{}}
+}
+
+func (f *FakeBackend) GetMapCount(vm uintptr, slot int) int {
+	return len(f.vm(vm).mapping(slot).keys)
+}
+
+func (f *FakeBackend) GetMapContainsKey(vm uintptr, mapSlot, keySlot int) bool {
+	v := f.vm(vm)
+	_, ok := v.mapping(mapSlot).values[v.mapKey(keySlot)]
+	return ok
+}
+
+func (f *FakeBackend) GetMapKey(vm uintptr, mapSlot, index, keySlot int) {
+	v := f.vm(vm)
+	mapping := v.mapping(mapSlot)
+	if index < 0 || index >= len(mapping.keys) {
+		panic(fmt.Sprintf("wrengo: fake backend: map index %d out of bounds", index))
+	}
+	*v.slot(keySlot) = mapping.keys[index]
+}
+
+func (f *FakeBackend) GetMapValue(vm uintptr, mapSlot, keySlot, valueSlot int) {
+	v := f.vm(vm)
+	*v.slot(valueSlot) = v.mapping(mapSlot).values[v.mapKey(keySlot)]
+}
+
+func (f *FakeBackend) SetMapValue(vm uintptr, mapSlot, keySlot, valueSlot int) {
+	v := f.vm(vm)
+	mapping := v.mapping(mapSlot)
+	key := v.mapKey(keySlot)
+	if _, exists := mapping.values[key]; !exists {
+		mapping.keys = append(mapping.keys, key)
+	}
+	mapping.values[key] = *v.slot(valueSlot)
+}
+
+func (f *FakeBackend) RemoveMapValue(vm uintptr, mapSlot, keySlot, removedValueSlot int) {
+	v := f.vm(vm)
+	mapping := v.mapping(mapSlot)
+	key := v.mapKey(keySlot)
+	removed, exists := mapping.values[key]
+	if exists {
+		delete(mapping.values, key)
+		for i, k := range mapping.keys {
+			if k == key {
+				mapping.keys = append(mapping.keys[:i], mapping.keys[i+1:]...)
+				break
+			}
+		}
+	}
+	if removedValueSlot >= 0 {
+		*v.slot(removedValueSlot) = removed
+	}
+}
+
+func (f *FakeBackend) MakeCallHandle(vm uintptr, signature string) uintptr {
+	return f.vm(vm).addHandle(fakeCallHandle{signature: signature})
+}
+
+func (f *FakeBackend) Call(vm uintptr, method uintptr) int {
+
+	v := f.vm(vm)
+
+	call, ok := v.handle(method).(fakeCallHandle)
+	if !ok {
+		panic(fmt.Sprintf("wrengo: fake backend: handle %d isn't a call handle", method))
+	}
+
+	argCount := strings.Count(call.signature, "_")
+	v.slot(argCount) // Make sure the receiver and arguments were set
+
+	receiver, ok := (*v.slot(0)).(*fakeObject)
+	if !ok {
+		return v.runtimeError(vm, fmt.Sprintf("receiver does not implement '%s'.", call.signature))
+	}
+
+	fn, ok := receiver.methods[call.signature]
+	if !ok {
+		return v.runtimeError(vm, fmt.Sprintf("%s does not implement '%s'.", receiver.name, call.signature))
+	}
+
+	args := []any{}
+	for _, arg := range v.slots[1 : argCount+1] {
+		args = append(args, fakeToGo(arg))
+	}
+
+	res, err := fn(args)
+	if err != nil {
+		return v.runtimeError(vm, err.Error())
+	}
+
+	result, ok := goToFake(res)
+	if !ok {
+		return v.runtimeError(vm, fmt.Sprintf("result ( %v ) cannot be converted", res))
+	}
+
+	// Like Wren, only the result is left in the slots
+	v.slots = []any{result}
+	return 0
+
+}
+
+func (f *FakeBackend) GetSlotHandle(vm uintptr, slot int) uintptr {
+	v := f.vm(vm)
+	return v.addHandle(*v.slot(slot))
+}
+
+func (f *FakeBackend) SetSlotHandle(vm uintptr, slot int, handle uintptr) {
+	v := f.vm(vm)
+	value := v.handle(handle)
+	if _, ok := value.(fakeCallHandle); ok {
+		panic(fmt.Sprintf("wrengo: fake backend: handle %d is a call handle", handle))
+	}
+	*v.slot(slot) = value
+}
+
+func (f *FakeBackend) ReleaseHandle(vm uintptr, handle uintptr) {
+	v := f.vm(vm)
+	v.handle(handle)
+	delete(v.handles, handle)
+}
+
+func (f *FakeBackend) GetVariable(vm uintptr, module, name string, slot int) {
+	v := f.vm(vm)
+	value, ok := v.modules[module][name]
+	if !ok {
+		panic(fmt.Sprintf("wrengo: fake backend: variable '%s' not found in module '%s'", name, module))
+	}
+	*v.slot(slot) = value
+}
+
+func (f *FakeBackend) HasVariable(vm uintptr, module, name string) bool {
+	_, ok := f.vm(vm).modules[module][name]
+	return ok
+}
+
+func (f *FakeBackend) HasModule(vm uintptr, module string) bool {
+	_, ok := f.vm(vm).modules[module]
+	return ok
+}
+
+func (f *FakeBackend) AbortFiber(vm uintptr, slot int) {
+	v := f.vm(vm)
+	v.aborted = *v.slot(slot) // Like in Wren, aborting with null doesn't abort the fiber
+}
+
+func (f *FakeBackend) CollectGarbage(vm uintptr) {}
+
+func (f *FakeBackend) SetSlotNewForeign(vm uintptr, slot, classSlot int, size uintptr) uintptr {
+	v := f.vm(vm)
+	class, ok := (*v.slot(classSlot)).(*fakeClass)
+	if !ok {
+		panic(fmt.Sprintf("wrengo: fake backend: slot %d must hold a foreign class", classSlot))
+	}
+	object := &FakeForeign{module: class.module, className: class.name, data: make([]uint64, max((size+7)/8, 1))}
+	v.objects = append(v.objects, object)
+	*v.slot(slot) = object
+	return uintptr(unsafe.Pointer(&object.data[0]))
+}
+
+func (f *FakeBackend) GetSlotForeign(vm uintptr, slot int) uintptr {
+	object, ok := (*f.vm(vm).slot(slot)).(*FakeForeign)
+	if !ok {
+		panic(fmt.Sprintf("wrengo: fake backend: slot %d must hold a foreign object", slot))
+	}
+	return uintptr(unsafe.Pointer(&object.data[0]))
+}
+
+func (f *FakeBackend) Close() error {
+	return nil
+}
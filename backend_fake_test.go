@@ -0,0 +1,258 @@
+package wrengo
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newFakeLibrary loads a library from a FakeBackend, which is closed when the test ends.
+func newFakeLibrary(t *testing.T) (*FakeBackend, *Library) {
+
+	t.Helper()
+
+	fake := NewFakeBackend()
+	lib, err := LoadBackend(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { lib.Close() })
+
+	return fake, lib
+
+}
+
+// newFakeVM creates a VM from a FakeBackend, with the configuration changed by configure, if it's set. Both are freed
+// when the test ends.
+func newFakeVM(t *testing.T, configure func(cfg Config) Config) (*FakeBackend, *VM) {
+
+	t.Helper()
+
+	fake, lib := newFakeLibrary(t)
+
+	cfg := lib.NewConfig().WithErrorHandler(nil)
+	if configure != nil {
+		cfg = configure(cfg)
+	}
+
+	vm := lib.NewVM(cfg)
+	t.Cleanup(func() { vm.Free() })
+
+	return fake, vm
+
+}
+
+// echo returns a resolver binding every foreign method to a function returning its arguments.
+func echo(result func(args []any) any) func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction {
+	return func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction {
+		return func(vm *VM, args []any) any { return result(args) }
+	}
+}
+
+// nested is a value with lists and maps inside each other, to convert back and forth through the slots.
+var nested = []any{
+	1.0,
+	"two",
+	[]any{true, nil, []any{3.0}},
+	map[any]any{"four": []any{4.0, map[any]any{5.0: "five"}}},
+}
+
+func TestSlotRoundTrip(t *testing.T) {
+
+	values := map[string]any{
+		"nil":    nil,
+		"bool":   true,
+		"number": 1.5,
+		"string": "text",
+		"list":   []any{1.0, "a", nil},
+		"map":    map[any]any{"a": 1.0, 2.0: false},
+		"nested": nested,
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+
+			fake, vm := newFakeVM(t, func(cfg Config) Config {
+				return cfg.WithForeignMethodResolver(echo(func(args []any) any { return args[0] }))
+			})
+
+			if err := fake.SetVariable(vm, "main", "value", value); err != nil {
+				t.Fatal(err)
+			}
+			if got := vm.Variable("main", "value"); !reflect.DeepEqual(got, value) {
+				t.Errorf("Variable() = %#v; want %#v", got, value)
+			}
+
+			// Through a foreign method's arguments and back out of slot 0
+			got, err := fake.CallForeign(vm, "main", "Echo", "echo(_)", true, value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, value) {
+				t.Errorf("CallForeign() = %#v; want %#v", got, value)
+			}
+
+		})
+	}
+
+}
+
+func TestSlotRoundTripKeepsFollowingArguments(t *testing.T) {
+
+	// Converting a list or map argument mustn't overwrite the arguments in the slots after it
+	fake, vm := newFakeVM(t, func(cfg Config) Config {
+		return cfg.WithForeignMethodResolver(echo(func(args []any) any { return args }))
+	})
+
+	fake.SetMethod(vm, "main", "Echo", "call(_,_,_)", func(args []any) (any, error) {
+		return args, nil
+	})
+
+	args := []any{nested, map[any]any{"key": []any{"value"}}, "last"}
+
+	handle, err := vm.CallHandle("main", "Echo", "call(_,_,_)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := handle.Call(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, args) {
+		t.Errorf("Call() = %#v; want %#v", got, args)
+	}
+
+	got, err = fake.CallForeign(vm, "main", "Echo", "echo(_,_,_)", true, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, args) {
+		t.Errorf("CallForeign() = %#v; want %#v", got, args)
+	}
+
+}
+
+func TestCallForeignDispatch(t *testing.T) {
+
+	var bound []string
+
+	fake, vm := newFakeVM(t, func(cfg Config) Config {
+		return cfg.WithForeignMethodResolver(func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction {
+			if className != "Game" {
+				return nil
+			}
+			bound = append(bound, signature)
+			return func(vm *VM, args []any) any {
+				if isStatic {
+					return "static " + signature
+				}
+				return signature
+			}
+		})
+	})
+
+	tests := []struct {
+		signature string
+		isStatic  bool
+		want      string
+	}{
+		{"level", true, "static level"},
+		{"level", false, "level"}, // Instance methods are told apart from static ones
+		{"move( _, _ )", true, "static move(_,_)"},
+		{"level", true, "static level"},
+	}
+
+	for _, test := range tests {
+		args := make([]any, strings.Count(test.signature, "_"))
+		got, err := fake.CallForeign(vm, "main", "Game", test.signature, test.isStatic, args...)
+		if err != nil {
+			t.Errorf("CallForeign(%q, %t): %v", test.signature, test.isStatic, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("CallForeign(%q, %t) = %v; want %v", test.signature, test.isStatic, got, test.want)
+		}
+	}
+
+	// Each method is bound once, the first time it's called
+	if want := []string{"level", "level", "move(_,_)"}; !reflect.DeepEqual(bound, want) {
+		t.Errorf("the resolver bound %q; want %q", bound, want)
+	}
+
+	if _, err := fake.CallForeign(vm, "main", "Missing", "name", true); err == nil {
+		t.Error("CallForeign() of an unbound method didn't fail")
+	}
+
+	if _, err := fake.CallForeign(vm, "main", "Game", "add(_,_)", true, 1); err == nil {
+		t.Error("CallForeign() with too few arguments didn't fail")
+	}
+
+}
+
+func TestCallForeignArguments(t *testing.T) {
+
+	var gotArgs []any
+
+	fake, vm := newFakeVM(t, func(cfg Config) Config {
+		return cfg.WithForeignMethodResolver(echo(func(args []any) any {
+			gotArgs = args
+			return args[0].(float64) + args[1].(float64)
+		}))
+	})
+
+	got, err := fake.CallForeign(vm, "main", "Math", "add(_,_)", true, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 3.0 {
+		t.Errorf("CallForeign() = %v; want 3", got)
+	}
+	if want := []any{1.0, 2.0}; !reflect.DeepEqual(gotArgs, want) {
+		t.Errorf("the foreign method got %#v; want %#v", gotArgs, want)
+	}
+
+}
+
+func TestCallHandleArguments(t *testing.T) {
+
+	fake, vm := newFakeVM(t, nil)
+
+	fake.SetMethod(vm, "main", "Math", "add(_,_)", func(args []any) (any, error) {
+		return args[0].(float64) + args[1].(float64), nil
+	})
+
+	add, err := vm.CallHandle("main", "Math", "add(_, _)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := add.Call(1, 2); err != nil || got != 3.0 {
+		t.Errorf("Call(1, 2) = %v, %v; want 3", got, err)
+	}
+
+	if _, err := add.Call(1); err == nil {
+		t.Error("Call() with too few arguments didn't fail")
+	}
+
+	if _, err := add.Call(1, struct{}{}); err == nil || !strings.Contains(err.Error(), "argument #1") {
+		t.Errorf("Call() with an argument that can't be converted returned %v", err)
+	}
+
+	fake.SetMethod(vm, "main", "Math", "fail()", func(args []any) (any, error) {
+		return nil, errors.New("failed")
+	})
+	fail, err := vm.CallHandle("main", "Math", "fail()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fail.Call(); err == nil {
+		t.Error("Call() of a method that aborts didn't fail")
+	}
+
+	if _, err := vm.CallHandle("main", "Missing", "call()"); err == nil {
+		t.Error("CallHandle() for a missing object didn't fail")
+	}
+
+}
@@ -0,0 +1,791 @@
+package wrengo
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/ebitengine/purego"
+)
+
+// puregoBackend is the default Backend; it calls into a Wren shared library loaded at runtime through purego.
+type puregoBackend struct {
+	handle    uintptr
+	libc      uintptr
+	available map[string]bool
+
+	// The C allocator, from the C standard library rather than Wren.
+	realloc func(memory uintptr, newSize uintptr) uintptr
+	free    func(memory uintptr)
+
+	initConfig func(config *wrenConfiguration)
+	newVM      func(config *wrenConfiguration) uintptr
+	interpret  func(vm uintptr, moduleName, text string) int
+	freeVM     func(vm uintptr)
+
+	ensureSlots  func(vm uintptr, slotCount int)
+	getSlotCount func(vm uintptr) int
+
+	setSlotBool   func(vm uintptr, slot int, value bool)
+	setSlotDouble func(vm uintptr, slot int, value float64)
+	setSlotNull   func(vm uintptr, slot int)
+	setSlotBytes  func(vm uintptr, slot int, bytes *byte, length uintptr)
+	setSlotString func(vm uintptr, slot int, text string)
+
+	getSlotBool   func(vm uintptr, slot int) bool
+	getSlotDouble func(vm uintptr, slot int) float64
+	getSlotString func(vm uintptr, slot int) string
+	getSlotBytes  func(vm uintptr, slot int, length *int32) *byte
+
+	setSlotNewList        func(vm uintptr, slot int)
+	getSlotListCount      func(vm uintptr, slot int) int
+	setSlotListElement    func(vm uintptr, listSlot, index, elementSlot int)
+	insertSlotListElement func(vm uintptr, listSlot, index, elementSlot int)
+	getSlotListElement    func(vm uintptr, listSlot, index, elementSlot int)
+
+	setSlotNewMap         func(vm uintptr, slot int)
+	getSlotMapCount       func(vm uintptr, mapSlot int) int
+	setSlotMapValue       func(vm uintptr, mapSlot, keySlot, valueSlot int)
+	removeSlotMapValue    func(vm uintptr, mapSlot, keySlot, removedValueSlot int)
+	getSlotMapContainsKey func(vm uintptr, mapSlot, keySlot int) bool
+	getSlotMapKey         func(vm uintptr, mapSlot, keyIndex, targetSlot int)
+	getSlotMapValue       func(vm uintptr, mapSlot, keySlot, valueSlot int)
+
+	getSlotType func(vm uintptr, slot int) int
+
+	getSlotHandle     func(vm uintptr, slot int) uintptr
+	makeCallHandle    func(vm uintptr, signature string) uintptr
+	call              func(vm uintptr, handle uintptr) int
+	releaseCallHandle func(vm uintptr, handle uintptr)
+
+	getVariable func(vm uintptr, module, name string, slot int)
+	hasVariable func(vm uintptr, module, name string) bool
+	hasModule   func(vm uintptr, module string) bool
+
+	getVersionNumber func() int
+
+	// Optional functions; these are only bound if the library exports them.
+	abortFiber        func(vm uintptr, slot int)
+	collectGarbage    func(vm uintptr)
+	setSlotNewForeign func(vm uintptr, slot, classSlot int, size uintptr) uintptr
+	getSlotForeign    func(vm uintptr, slot int) uintptr
+	setSlotHandle     func(vm uintptr, slot int, handle uintptr)
+	getUserData       func(vm uintptr) uintptr
+	setUserData       func(vm uintptr, userData uintptr)
+}
+
+// puregoVM holds the state the backend keeps for each VM.
+type puregoVM struct {
+	backend *puregoBackend
+	config  *BackendConfig
+
+	// id is the ID the VM is created with, which is stored as its user data (see puregoReallocate()).
+	id uintptr
+
+	// moduleSource is the C copy of the last module source handed to Wren, which is freed once Wren is done
+	// compiling it (see NewVM()).
+	moduleSource uintptr
+
+	// foreignClasses holds the WrenForeignClassMethods (allocate and finalize) bound for each foreign class, which
+	// Wren copies out of them through wrengoBindForeignClassThunk.
+	foreignClasses []*[2]uintptr
+
+	// The functions called through the foreign trampolines (see puregoCallForeign()): the VM's foreign methods, and
+	// the allocators of its foreign classes.
+	foreignMethods []func(vm uintptr)
+}
+
+// puregoVMs maps each VM created through purego to its state, and puregoVMIDs maps the ID each VM is created with to
+// the same. They're shared by every puregoBackend, as the callbacks are shared by every VM, and only have the VM's
+// pointer (or its ID, or not even that) to go on.
+var puregoVMs = map[uintptr]*puregoVM{}
+var puregoVMIDs = map[uintptr]*puregoVM{}
+var puregoVMsLock sync.RWMutex
+var puregoNextVMID uintptr
+
+// puregoForeignTrampolines is the number of trampolines wrengo can hand to Wren as foreign methods for each VM; it
+// must match the number in wrengoForeignTrampolines, in backend_purego_GOARCH.s. The last one is kept for the
+// foreign methods and classes bound once the others have run out, and aborts the fiber saying so (see
+// puregoTooManyForeignMethods()), so a VM can bind at most puregoForeignTrampolines - 1 of them.
+const puregoForeignTrampolines = 1000
+
+// puregoTooManyForeignMethods is the message the fiber is aborted with when it calls a foreign method (or constructs
+// a foreign class) bound once the VM's foreign trampolines have run out.
+var puregoTooManyForeignMethods = fmt.Sprintf("Too many foreign methods and classes bound in one VM; at most %d can be.", puregoForeignTrampolines-1)
+
+// puregoForeignCallbacks is the most callbacks created for foreign methods over the life of the process, on
+// platforms without foreign trampolines. purego can only create around 2000 callbacks, and panics past that, so
+// the rest are left for the shared callbacks below, and for the program's own. Foreign methods bound once they've
+// run out get puregoTooManyForeignCallbacksFn instead, which aborts the fiber saying so.
+const puregoForeignCallbacks = 1800
+
+var puregoForeignCallbacksCreated int // Guarded by puregoVMsLock
+
+// puregoTooManyForeignCallbacks is the message the fiber is aborted with when it calls a foreign method bound once
+// the foreign callbacks have run out.
+var puregoTooManyForeignCallbacks = fmt.Sprintf("Too many foreign methods bound; on this platform, at most %d can be over the life of the process.", puregoForeignCallbacks)
+
+// The callbacks handed to Wren. purego can only create a limited number of callbacks, and never frees them, so
+// they're created once and shared by every VM, rather than created for each VM (or each foreign method), and find
+// the VM's state in puregoVMs. wrengoBindForeignClassThunk calls puregoBindForeignClassFn to bind each foreign
+// class, and the foreign trampolines call puregoCallForeignFn.
+var (
+	puregoReallocateFn        uintptr
+	puregoResolveModuleFn     uintptr
+	puregoWriteFn             uintptr
+	puregoErrorFn             uintptr
+	puregoLoadModuleFn        uintptr
+	puregoBindForeignMethodFn uintptr
+	puregoBindForeignClassFn  uintptr
+	puregoFinalizeForeignFn   uintptr
+	puregoCallForeignFn       uintptr
+	puregoCallbacksOnce       sync.Once
+)
+
+// puregoNoForeignClass is the WrenForeignClassMethods for classes that aren't bound to Go.
+var puregoNoForeignClass [2]uintptr
+
+// puregoForeignHeaderSize is the size of the header the backend adds before the data of each foreign object, which
+// holds the pointer to the object's VM; it keeps the data aligned as malloc() would.
+const puregoForeignHeaderSize = 16
+
+// wrenConfiguration mirrors the layout of Wren's WrenConfiguration struct.
+type wrenConfiguration struct {
+	reallocateFn        uintptr
+	resolveModuleFn     uintptr
+	loadModuleFn        uintptr
+	bindForeignMethodFn uintptr
+	bindForeignClassFn  uintptr
+	writeFn             uintptr
+	errorFn             uintptr
+	initialHeapSize     uintptr
+	minHeapSize         uintptr
+	heapGrowthPercent   int32
+	userData            uintptr
+}
+
+// newPuregoBackend binds the Wren C API functions from the loaded library handle.
+func newPuregoBackend(handle uintptr) (*puregoBackend, error) {
+
+	b := &puregoBackend{
+		handle:    handle,
+		available: map[string]bool{},
+	}
+
+	missing := []string{}
+	addresses := map[string]uintptr{}
+
+	// Look every symbol up before binding any of them, so a library that's missing functions is reported in full
+	// rather than panicking on the first one.
+	for _, sym := range b.symbols() {
+		addr, err := lookupSymbol(handle, sym.name)
+		if err != nil || addr == 0 {
+			if !sym.optional {
+				missing = append(missing, sym.name)
+			}
+			continue
+		}
+		addresses[sym.name] = addr
+	}
+
+	if len(missing) > 0 {
+		return nil, &MissingSymbolsError{Symbols: missing}
+	}
+
+	libc, err := loadCLibrary()
+	if err != nil {
+		return nil, fmt.Errorf("error loading the C standard library: %w", err)
+	}
+
+	for _, name := range []string{"realloc", "free"} {
+		addr, err := lookupSymbol(libc, name)
+		if err != nil || addr == 0 {
+			closeLibrary(libc)
+			return nil, fmt.Errorf("error loading %s() from the C standard library: %v", name, err)
+		}
+		addresses[name] = addr
+	}
+
+	b.libc = libc
+	purego.RegisterFunc(&b.realloc, addresses["realloc"])
+	purego.RegisterFunc(&b.free, addresses["free"])
+
+	for _, sym := range b.symbols() {
+		if addr, ok := addresses[sym.name]; ok {
+			purego.RegisterFunc(sym.fptr, addr)
+			b.available[sym.name] = true
+		}
+	}
+
+	// Foreign classes can't be bound without the thunk to return their methods to Wren, so without it, the
+	// functions for them are of no use.
+	if puregoForeignClassThunk() == 0 {
+		delete(b.available, "wrenSetSlotNewForeign")
+		delete(b.available, "wrenGetSlotForeign")
+	}
+
+	return b, nil
+
+}
+
+// librarySymbol is a Wren C API function, along with the Go function variable it's bound to.
+type librarySymbol struct {
+	name     string
+	fptr     any
+	optional bool
+}
+
+// symbols returns every C API function the bindings use.
+func (b *puregoBackend) symbols() []librarySymbol {
+	return []librarySymbol{
+		{name: "wrenGetVersionNumber", fptr: &b.getVersionNumber},
+		{name: "wrenInitConfiguration", fptr: &b.initConfig},
+		{name: "wrenNewVM", fptr: &b.newVM},
+		{name: "wrenInterpret", fptr: &b.interpret},
+		{name: "wrenFreeVM", fptr: &b.freeVM},
+
+		{name: "wrenMakeCallHandle", fptr: &b.makeCallHandle},
+		{name: "wrenCall", fptr: &b.call},
+		{name: "wrenReleaseHandle", fptr: &b.releaseCallHandle},
+		{name: "wrenGetSlotHandle", fptr: &b.getSlotHandle},
+
+		{name: "wrenGetVariable", fptr: &b.getVariable},
+		{name: "wrenHasVariable", fptr: &b.hasVariable},
+		{name: "wrenHasModule", fptr: &b.hasModule},
+
+		{name: "wrenEnsureSlots", fptr: &b.ensureSlots},
+		{name: "wrenGetSlotCount", fptr: &b.getSlotCount},
+
+		{name: "wrenSetSlotBool", fptr: &b.setSlotBool},
+		{name: "wrenSetSlotDouble", fptr: &b.setSlotDouble},
+		{name: "wrenSetSlotNull", fptr: &b.setSlotNull},
+		{name: "wrenSetSlotBytes", fptr: &b.setSlotBytes},
+		{name: "wrenSetSlotString", fptr: &b.setSlotString},
+
+		{name: "wrenSetSlotNewList", fptr: &b.setSlotNewList},
+		{name: "wrenSetListElement", fptr: &b.setSlotListElement},
+		{name: "wrenInsertInList", fptr: &b.insertSlotListElement},
+		{name: "wrenGetListCount", fptr: &b.getSlotListCount},
+		{name: "wrenGetListElement", fptr: &b.getSlotListElement},
+
+		{name: "wrenSetSlotNewMap", fptr: &b.setSlotNewMap},
+		{name: "wrenSetMapValue", fptr: &b.setSlotMapValue},
+		{name: "wrenRemoveMapValue", fptr: &b.removeSlotMapValue},
+		{name: "wrenGetMapCount", fptr: &b.getSlotMapCount},
+		{name: "wrenGetMapContainsKey", fptr: &b.getSlotMapContainsKey},
+		{name: "wrenGetMapKey", fptr: &b.getSlotMapKey},
+		{name: "wrenGetMapValue", fptr: &b.getSlotMapValue},
+
+		{name: "wrenGetSlotBool", fptr: &b.getSlotBool},
+		{name: "wrenGetSlotDouble", fptr: &b.getSlotDouble},
+		{name: "wrenGetSlotBytes", fptr: &b.getSlotBytes},
+		{name: "wrenGetSlotString", fptr: &b.getSlotString},
+		{name: "wrenGetSlotType", fptr: &b.getSlotType},
+
+		{name: "wrenAbortFiber", fptr: &b.abortFiber, optional: true},
+		{name: "wrenCollectGarbage", fptr: &b.collectGarbage, optional: true},
+		{name: "wrenSetSlotNewForeign", fptr: &b.setSlotNewForeign, optional: true},
+		{name: "wrenGetSlotForeign", fptr: &b.getSlotForeign, optional: true},
+		{name: "wrenSetSlotHandle", fptr: &b.setSlotHandle, optional: true},
+		{name: "wrenGetUserData", fptr: &b.getUserData, optional: true},
+		{name: "wrenSetUserData", fptr: &b.setUserData, optional: true},
+	}
+}
+
+func (b *puregoBackend) VersionNumber() int {
+	return b.getVersionNumber()
+}
+
+func (b *puregoBackend) HasFunction(name string) bool {
+	return b.available[name]
+}
+
+func (b *puregoBackend) NewVM(config *BackendConfig) uintptr {
+
+	wrenConfig := wrenConfiguration{}
+	state := &puregoVM{backend: b, config: config}
+
+	b.initConfig(&wrenConfig)
+
+	if config.InitialHeapSize > 0 {
+		wrenConfig.initialHeapSize = uintptr(config.InitialHeapSize)
+	}
+	if config.MinHeapSize > 0 {
+		wrenConfig.minHeapSize = uintptr(config.MinHeapSize)
+	}
+	if config.HeapGrowthPercent > 0 {
+		wrenConfig.heapGrowthPercent = int32(config.HeapGrowthPercent)
+	}
+
+	puregoCallbacksOnce.Do(func() {
+		puregoReallocateFn = purego.NewCallback(puregoReallocate)
+		puregoResolveModuleFn = purego.NewCallback(puregoResolveModule)
+		puregoWriteFn = purego.NewCallback(puregoWrite)
+		puregoErrorFn = purego.NewCallback(puregoError)
+		puregoLoadModuleFn = purego.NewCallback(puregoLoadModule)
+		puregoBindForeignMethodFn = purego.NewCallback(puregoBindForeignMethod)
+		puregoBindForeignClassFn = purego.NewCallback(puregoBindForeignClass)
+		puregoFinalizeForeignFn = purego.NewCallback(puregoFinalizeForeign)
+		puregoCallForeignFn = purego.NewCallback(puregoCallForeign)
+	})
+
+	if config.Reallocate != nil {
+		wrenConfig.reallocateFn = puregoReallocateFn
+	}
+	if config.ResolveModule != nil {
+		wrenConfig.resolveModuleFn = puregoResolveModuleFn
+	}
+	if config.Write != nil {
+		wrenConfig.writeFn = puregoWriteFn
+	}
+	if config.Error != nil {
+		wrenConfig.errorFn = puregoErrorFn
+	}
+	if config.LoadModule != nil {
+		wrenConfig.loadModuleFn = puregoLoadModuleFn
+	}
+	if config.BindForeignMethod != nil {
+		wrenConfig.bindForeignMethodFn = puregoBindForeignMethodFn
+	}
+	if config.BindForeignClass != nil && b.available["wrenSetSlotNewForeign"] {
+		wrenConfig.bindForeignClassFn = puregoForeignClassThunk()
+	}
+
+	// Wren allocates memory through the reallocate callback before the VM's pointer is known, so the callback finds
+	// the VM by the ID in its user data instead.
+	puregoVMsLock.Lock()
+	puregoNextVMID++
+	state.id = puregoNextVMID
+	puregoVMIDs[state.id] = state
+	puregoVMsLock.Unlock()
+
+	wrenConfig.userData = state.id
+
+	vm := b.newVM(&wrenConfig)
+
+	puregoVMsLock.Lock()
+	puregoVMs[vm] = state
+	puregoVMsLock.Unlock()
+
+	return vm
+
+}
+
+func puregoLookupVM(vm uintptr) *puregoVM {
+	puregoVMsLock.RLock()
+	defer puregoVMsLock.RUnlock()
+	return puregoVMs[vm]
+}
+
+func puregoReallocate(memory, newSize, userData uintptr) uintptr {
+	puregoVMsLock.RLock()
+	state := puregoVMIDs[userData]
+	puregoVMsLock.RUnlock()
+	if state == nil {
+		return 0
+	}
+	return state.config.Reallocate(memory, newSize)
+}
+
+func puregoResolveModule(vm uintptr, importer, name *byte) uintptr {
+
+	state := puregoLookupVM(vm)
+	if state == nil {
+		return uintptr(unsafe.Pointer(name))
+	}
+
+	resolved := state.config.ResolveModule(vm, BytePtrToString(importer), BytePtrToString(name))
+	// Wren takes ownership of the resolved name, unless it's the name it passed in.
+	if resolved == BytePtrToString(name) {
+		return uintptr(unsafe.Pointer(name))
+	}
+
+	allocate := state.config.Reallocate
+	if allocate == nil {
+		allocate = state.backend.Reallocate
+	}
+	return allocateCString(allocate, resolved)
+
+}
+
+func puregoWrite(vm uintptr, text *byte) {
+	if state := puregoLookupVM(vm); state != nil {
+		state.config.Write(vm, BytePtrToString(text))
+	}
+}
+
+func puregoError(vm uintptr, errorType int, module *byte, line int, msg *byte) {
+	if state := puregoLookupVM(vm); state != nil {
+		state.config.Error(vm, errorType, BytePtrToString(module), line, BytePtrToString(msg))
+	}
+}
+
+// puregoLoadModule loads a module's source. The shipped Wren libraries are built so the load module callback
+// returns the source directly, rather than a WrenLoadModuleResult (which purego callbacks can't return anyway), so
+// there's no onComplete callback to say when Wren is done with the source. Instead, the source is copied into C
+// memory that's kept until the next module is loaded, or the call into the VM returns; Wren compiles each module
+// as soon as it's loaded, so by then it's done with the previous source.
+func puregoLoadModule(vm uintptr, modName *byte) uintptr {
+
+	state := puregoLookupVM(vm)
+	if state == nil {
+		return 0
+	}
+
+	res := state.config.LoadModule(vm, BytePtrToString(modName))
+	state.backend.freeModuleSource(state)
+	if res == nil {
+		return 0
+	}
+
+	state.moduleSource = allocateCString(state.backend.Reallocate, string(res))
+	return state.moduleSource
+
+}
+
+// puregoBindForeignMethod returns the function Wren should call for the foreign method: one of the foreign
+// trampolines, or, on platforms without them, a callback of its own. purego can only create a limited number of
+// callbacks (around 2000) and never frees them, so on those platforms the number of foreign methods bound over
+// the life of the process is bounded, however many VMs they're bound in.
+func puregoBindForeignMethod(vm uintptr, module, className *byte, isStatic bool, signature *byte) uintptr {
+
+	state := puregoLookupVM(vm)
+	if state == nil {
+		return 0
+	}
+
+	fn := state.config.BindForeignMethod(vm, BytePtrToString(module), BytePtrToString(className), isStatic, BytePtrToString(signature))
+	if fn == nil {
+		return 0
+	}
+
+	if puregoForeignTrampoline(0) == 0 {
+		return puregoForeignCallback(fn)
+	}
+
+	return state.addTrampoline(fn)
+
+}
+
+// puregoForeignCallback creates a callback for the foreign method, on platforms without foreign trampolines, or
+// returns the one that aborts the fiber if there are as many as puregoForeignCallbacks allows already.
+func puregoForeignCallback(fn func(vm uintptr)) uintptr {
+
+	puregoVMsLock.Lock()
+	defer puregoVMsLock.Unlock()
+
+	if puregoForeignCallbacksCreated >= puregoForeignCallbacks {
+		return puregoTooManyForeignCallbacksFn()
+	}
+
+	puregoForeignCallbacksCreated++
+	return purego.NewCallback(fn)
+
+}
+
+// puregoTooManyForeignCallbacksFn returns the callback bound in place of the foreign methods bound once the foreign
+// callbacks have run out, creating it the first time.
+var puregoTooManyForeignCallbacksFn = sync.OnceValue(func() uintptr {
+	return purego.NewCallback(func(vm uintptr) {
+		if state := puregoLookupVM(vm); state != nil {
+			state.abortForeign(vm, puregoTooManyForeignCallbacks)
+		}
+	})
+})
+
+// addTrampoline adds the function to those called through the VM's foreign trampolines, returning the trampoline
+// that calls it, or 0 if there are none left.
+func (state *puregoVM) addTrampoline(fn func(vm uintptr)) uintptr {
+
+	puregoVMsLock.Lock()
+	defer puregoVMsLock.Unlock()
+
+	last := puregoForeignTrampolines - 1
+
+	if len(state.foreignMethods) >= last {
+		if len(state.foreignMethods) == last {
+			state.foreignMethods = append(state.foreignMethods, func(vm uintptr) {
+				state.abortForeign(vm, puregoTooManyForeignMethods)
+			})
+		}
+		return puregoForeignTrampoline(last)
+	}
+
+	state.foreignMethods = append(state.foreignMethods, fn)
+	return puregoForeignTrampoline(len(state.foreignMethods) - 1)
+
+}
+
+// abortForeign aborts the fiber with the message, in place of a foreign method or allocator that couldn't be bound;
+// it's called through the last foreign trampoline once the others have run out, for one.
+func (state *puregoVM) abortForeign(vm uintptr, message string) {
+	if state.backend.abortFiber != nil {
+		state.backend.setSlotString(vm, 0, message)
+		state.backend.abortFiber(vm, 0)
+	}
+}
+
+// puregoCallForeign is called by the foreign trampoline with the given index, and calls the function the VM bound
+// to it.
+func puregoCallForeign(vm uintptr, index uintptr) {
+
+	state := puregoLookupVM(vm)
+	if state == nil {
+		return
+	}
+
+	puregoVMsLock.RLock()
+	fn := state.foreignMethods[index]
+	puregoVMsLock.RUnlock()
+
+	fn(vm)
+
+}
+
+// puregoBindForeignClass is called by wrengoBindForeignClassThunk to bind a foreign class, returning a pointer to
+// its WrenForeignClassMethods.
+func puregoBindForeignClass(vm uintptr, module, className *byte) uintptr {
+
+	state := puregoLookupVM(vm)
+	if state == nil {
+		return uintptr(unsafe.Pointer(&puregoNoForeignClass))
+	}
+
+	allocate := state.config.BindForeignClass(vm, BytePtrToString(module), BytePtrToString(className))
+	if allocate == nil {
+		return uintptr(unsafe.Pointer(&puregoNoForeignClass))
+	}
+
+	trampoline := state.addTrampoline(allocate)
+
+	methods := &[2]uintptr{trampoline, puregoFinalizeForeignFn}
+
+	puregoVMsLock.Lock()
+	state.foreignClasses = append(state.foreignClasses, methods)
+	puregoVMsLock.Unlock()
+
+	return uintptr(unsafe.Pointer(methods))
+
+}
+
+// puregoFinalizeForeign is the finalizer of every foreign class bound by the backend; it finds the object's VM
+// from the header before the object's data (see SetSlotNewForeign()).
+func puregoFinalizeForeign(data uintptr) {
+	if state := puregoLookupVM(*(*uintptr)(cPointer(data))); state != nil {
+		state.config.FinalizeForeign(data + puregoForeignHeaderSize)
+	}
+}
+
+// freeModuleSource frees the VM's copy of the last module source loaded, if there is one.
+func (b *puregoBackend) freeModuleSource(state *puregoVM) {
+	if state.moduleSource != 0 {
+		b.Reallocate(state.moduleSource, 0)
+		state.moduleSource = 0
+	}
+}
+
+// callReturned is called once a call into the VM returns, when Wren is done with any module source it loaded.
+func (b *puregoBackend) callReturned(vm uintptr) {
+	if state := puregoLookupVM(vm); state != nil {
+		b.freeModuleSource(state)
+	}
+}
+
+func (b *puregoBackend) Reallocate(memory uintptr, newSize uintptr) uintptr {
+	if newSize == 0 {
+		b.free(memory)
+		return 0
+	}
+	return b.realloc(memory, newSize)
+}
+
+// allocateCString copies the string into NUL-terminated memory allocated with the given allocator.
+func allocateCString(allocate func(memory uintptr, newSize uintptr) uintptr, text string) uintptr {
+	memory := allocate(0, uintptr(len(text)+1))
+	if memory == 0 {
+		return 0
+	}
+	buffer := unsafe.Slice((*byte)(cPointer(memory)), len(text)+1)
+	copy(buffer, text)
+	buffer[len(text)] = 0
+	return memory
+}
+
+func (b *puregoBackend) FreeVM(vm uintptr) {
+	b.freeVM(vm)
+	b.callReturned(vm)
+
+	puregoVMsLock.Lock()
+	if state := puregoVMs[vm]; state != nil {
+		delete(puregoVMIDs, state.id)
+	}
+	delete(puregoVMs, vm)
+	puregoVMsLock.Unlock()
+}
+
+func (b *puregoBackend) Interpret(vm uintptr, module, source string) int {
+	defer b.callReturned(vm)
+	return b.interpret(vm, module, source)
+}
+
+func (b *puregoBackend) EnsureSlots(vm uintptr, slotCount int) {
+	b.ensureSlots(vm, slotCount)
+}
+
+func (b *puregoBackend) GetSlotCount(vm uintptr) int {
+	return b.getSlotCount(vm)
+}
+
+func (b *puregoBackend) GetSlotType(vm uintptr, slot int) int {
+	return b.getSlotType(vm, slot)
+}
+
+func (b *puregoBackend) SetSlotBool(vm uintptr, slot int, value bool) {
+	b.setSlotBool(vm, slot, value)
+}
+
+func (b *puregoBackend) SetSlotDouble(vm uintptr, slot int, value float64) {
+	b.setSlotDouble(vm, slot, value)
+}
+
+func (b *puregoBackend) SetSlotNull(vm uintptr, slot int) {
+	b.setSlotNull(vm, slot)
+}
+
+func (b *puregoBackend) SetSlotBytes(vm uintptr, slot int, bytes []byte) {
+	// Wren copies the bytes, so they only need to live for the duration of the call.
+	var ptr *byte
+	if len(bytes) > 0 {
+		ptr = &bytes[0]
+	}
+	b.setSlotBytes(vm, slot, ptr, uintptr(len(bytes)))
+}
+
+func (b *puregoBackend) SetSlotString(vm uintptr, slot int, text string) {
+	b.setSlotString(vm, slot, text)
+}
+
+func (b *puregoBackend) GetSlotBool(vm uintptr, slot int) bool {
+	return b.getSlotBool(vm, slot)
+}
+
+func (b *puregoBackend) GetSlotDouble(vm uintptr, slot int) float64 {
+	return b.getSlotDouble(vm, slot)
+}
+
+func (b *puregoBackend) GetSlotString(vm uintptr, slot int) string {
+	return b.getSlotString(vm, slot)
+}
+
+func (b *puregoBackend) GetSlotBytes(vm uintptr, slot int) []byte {
+	length := int32(0)
+	ptr := b.getSlotBytes(vm, slot, &length)
+	if ptr == nil || length <= 0 {
+		return []byte{}
+	}
+	return append([]byte(nil), unsafe.Slice(ptr, length)...)
+}
+
+func (b *puregoBackend) SetSlotNewList(vm uintptr, slot int) {
+	b.setSlotNewList(vm, slot)
+}
+
+func (b *puregoBackend) GetListCount(vm uintptr, slot int) int {
+	return b.getSlotListCount(vm, slot)
+}
+
+func (b *puregoBackend) GetListElement(vm uintptr, listSlot, index, elementSlot int) {
+	b.getSlotListElement(vm, listSlot, index, elementSlot)
+}
+
+func (b *puregoBackend) SetListElement(vm uintptr, listSlot, index, elementSlot int) {
+	b.setSlotListElement(vm, listSlot, index, elementSlot)
+}
+
+func (b *puregoBackend) InsertInList(vm uintptr, listSlot, index, elementSlot int) {
+	b.insertSlotListElement(vm, listSlot, index, elementSlot)
+}
+
+func (b *puregoBackend) SetSlotNewMap(vm uintptr, slot int) {
+	b.setSlotNewMap(vm, slot)
+}
+
+func (b *puregoBackend) GetMapCount(vm uintptr, slot int) int {
+	return b.getSlotMapCount(vm, slot)
+}
+
+func (b *puregoBackend) GetMapContainsKey(vm uintptr, mapSlot, keySlot int) bool {
+	return b.getSlotMapContainsKey(vm, mapSlot, keySlot)
+}
+
+func (b *puregoBackend) GetMapKey(vm uintptr, mapSlot, index, keySlot int) {
+	b.getSlotMapKey(vm, mapSlot, index, keySlot)
+}
+
+func (b *puregoBackend) GetMapValue(vm uintptr, mapSlot, keySlot, valueSlot int) {
+	b.getSlotMapValue(vm, mapSlot, keySlot, valueSlot)
+}
+
+func (b *puregoBackend) SetMapValue(vm uintptr, mapSlot, keySlot, valueSlot int) {
+	b.setSlotMapValue(vm, mapSlot, keySlot, valueSlot)
+}
+
+func (b *puregoBackend) RemoveMapValue(vm uintptr, mapSlot, keySlot, removedValueSlot int) {
+	b.removeSlotMapValue(vm, mapSlot, keySlot, removedValueSlot)
+}
+
+func (b *puregoBackend) MakeCallHandle(vm uintptr, signature string) uintptr {
+	return b.makeCallHandle(vm, signature)
+}
+
+func (b *puregoBackend) Call(vm uintptr, method uintptr) int {
+	defer b.callReturned(vm)
+	return b.call(vm, method)
+}
+
+func (b *puregoBackend) GetSlotHandle(vm uintptr, slot int) uintptr {
+	return b.getSlotHandle(vm, slot)
+}
+
+func (b *puregoBackend) SetSlotHandle(vm uintptr, slot int, handle uintptr) {
+	b.setSlotHandle(vm, slot, handle)
+}
+
+func (b *puregoBackend) ReleaseHandle(vm uintptr, handle uintptr) {
+	b.releaseCallHandle(vm, handle)
+}
+
+func (b *puregoBackend) GetVariable(vm uintptr, module, name string, slot int) {
+	b.getVariable(vm, module, name, slot)
+}
+
+func (b *puregoBackend) HasVariable(vm uintptr, module, name string) bool {
+	return b.hasVariable(vm, module, name)
+}
+
+func (b *puregoBackend) HasModule(vm uintptr, module string) bool {
+	return b.hasModule(vm, module)
+}
+
+func (b *puregoBackend) AbortFiber(vm uintptr, slot int) {
+	b.abortFiber(vm, slot)
+}
+
+func (b *puregoBackend) CollectGarbage(vm uintptr) {
+	b.collectGarbage(vm)
+}
+
+func (b *puregoBackend) SetSlotNewForeign(vm uintptr, slot, classSlot int, size uintptr) uintptr {
+	data := b.setSlotNewForeign(vm, slot, classSlot, size+puregoForeignHeaderSize)
+	*(*uintptr)(cPointer(data)) = vm
+	return data + puregoForeignHeaderSize
+}
+
+func (b *puregoBackend) GetSlotForeign(vm uintptr, slot int) uintptr {
+	return b.getSlotForeign(vm, slot) + puregoForeignHeaderSize
+}
+
+func (b *puregoBackend) Close() error {
+	closeLibrary(b.libc)
+	return closeLibrary(b.handle)
+}
@@ -0,0 +1,48 @@
+//go:build (darwin || linux) && !(cgo && wrengo_static)
+
+#include "textflag.h"
+
+// wrengoBindForeignClassThunk is the bindForeignClassFn the purego backend hands to Wren. purego callbacks can't
+// return structs, so it calls the callback in puregoBindForeignClassFn with the same arguments, which returns a
+// pointer to the WrenForeignClassMethods to bind, and returns those by value, in R0 and R1.
+TEXT wrengoBindForeignClassThunk(SB), NOSPLIT|NOFRAME, $0
+	STP.W (R29, R30), -16(RSP) // Save the frame pointer and link register across the call
+	MOVD  RSP, R29
+	MOVD  $·puregoBindForeignClassFn(SB), R16 // Not loaded directly, which would clobber R27 (callee-saved in C)
+	MOVD  (R16), R16
+	CALL  (R16)
+	LDP.P 16(RSP), (R29, R30)
+	MOVD  8(R0), R1
+	MOVD  0(R0), R0
+	RET
+
+// Wren's foreign methods only receive the VM, so each bound method of a VM gets its own trampoline, which the
+// dispatcher tells apart by the return address of its CALL. WRENGO_TRAMPOLINE must stay the same size (see
+// puregoTrampolineSize()), and there must be puregoForeignTrampolines of them.
+#define WRENGO_TRAMPOLINE MOVD R30, R9; CALL wrengoForeignDispatch(SB)
+#define WRENGO_TRAMPOLINES_10 WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE
+#define WRENGO_TRAMPOLINES_100 WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10
+
+TEXT wrengoForeignTrampolines(SB), NOSPLIT|NOFRAME, $0
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+
+// wrengoForeignDispatch calls the callback in puregoCallForeignFn with the VM and the index of the trampoline that
+// called it, restoring the link register the trampoline saved in R9, so the callback returns straight to Wren.
+TEXT wrengoForeignDispatch(SB), NOSPLIT|NOFRAME, $0
+	MOVD $wrengoForeignTrampolines(SB), R1
+	SUB  R1, R30, R1 // (index + 1) * 8
+	LSR  $3, R1, R1
+	SUB  $1, R1, R1
+	MOVD R9, R30
+	MOVD $·puregoCallForeignFn(SB), R16
+	MOVD (R16), R16
+	JMP  (R16)
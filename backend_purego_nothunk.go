@@ -0,0 +1,17 @@
+//go:build !(((darwin || linux) && (amd64 || arm64)) || (windows && amd64)) || (cgo && wrengo_static)
+
+package wrengo
+
+// puregoForeignClassThunk returns the address of the function the purego backend hands to Wren as its
+// bindForeignClassFn, or 0 if there isn't one for this platform. There's never one in builds using the
+// wrengo_static tag, as packages using cgo can't contain Go assembly; foreign classes work through the cgo backend
+// there instead.
+func puregoForeignClassThunk() uintptr {
+	return 0
+}
+
+// puregoForeignTrampoline returns the address of the trampoline with the given index, which calls
+// puregoCallForeignFn with the VM and the index, or 0 if there isn't one for this platform.
+func puregoForeignTrampoline(index int) uintptr {
+	return 0
+}
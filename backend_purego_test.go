@@ -0,0 +1,32 @@
+package wrengo
+
+import "testing"
+
+func TestPuregoForeignCallbackBudget(t *testing.T) {
+
+	puregoVMsLock.Lock()
+	created := puregoForeignCallbacksCreated
+	puregoForeignCallbacksCreated = puregoForeignCallbacks
+	puregoVMsLock.Unlock()
+
+	t.Cleanup(func() {
+		puregoVMsLock.Lock()
+		puregoForeignCallbacksCreated = created
+		puregoVMsLock.Unlock()
+	})
+
+	// Past the budget, foreign methods share the callback that aborts the fiber, rather than creating more
+	first := puregoForeignCallback(func(vm uintptr) {})
+	second := puregoForeignCallback(func(vm uintptr) {})
+
+	if first == 0 || first != second || first != puregoTooManyForeignCallbacksFn() {
+		t.Errorf("puregoForeignCallback() past the budget returned %#x and %#x; want the shared callback, %#x", first, second, puregoTooManyForeignCallbacksFn())
+	}
+
+	puregoVMsLock.Lock()
+	defer puregoVMsLock.Unlock()
+	if puregoForeignCallbacksCreated != puregoForeignCallbacks {
+		t.Errorf("%d foreign callbacks were counted; want %d", puregoForeignCallbacksCreated, puregoForeignCallbacks)
+	}
+
+}
@@ -0,0 +1,39 @@
+//go:build (((darwin || linux) && (amd64 || arm64)) || (windows && amd64)) && !(cgo && wrengo_static)
+
+package wrengo
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// puregoForeignClassThunkCode is the start of wrengoBindForeignClassThunk, from backend_purego_GOARCH.s.
+//
+//go:linkname puregoForeignClassThunkCode wrengoBindForeignClassThunk
+var puregoForeignClassThunkCode byte
+
+// puregoForeignClassThunk returns the address of the function the purego backend hands to Wren as its
+// bindForeignClassFn, or 0 if there isn't one for this platform.
+func puregoForeignClassThunk() uintptr {
+	return uintptr(unsafe.Pointer(&puregoForeignClassThunkCode))
+}
+
+// puregoForeignTrampolineCode is the start of wrengoForeignTrampolines, from backend_purego_GOARCH.s.
+//
+//go:linkname puregoForeignTrampolineCode wrengoForeignTrampolines
+var puregoForeignTrampolineCode byte
+
+// puregoTrampolineSize is the size of each of the trampolines in wrengoForeignTrampolines: a CALL on amd64, or a
+// MOVD and a CALL on arm64.
+func puregoTrampolineSize() uintptr {
+	if runtime.GOARCH == "arm64" {
+		return 8
+	}
+	return 5
+}
+
+// puregoForeignTrampoline returns the address of the trampoline with the given index, which calls
+// puregoCallForeignFn with the VM and the index, or 0 if there isn't one for this platform.
+func puregoForeignTrampoline(index int) uintptr {
+	return uintptr(unsafe.Pointer(&puregoForeignTrampolineCode)) + uintptr(index)*puregoTrampolineSize()
+}
@@ -0,0 +1,57 @@
+//go:build !(cgo && wrengo_static)
+
+#include "textflag.h"
+
+// wrengoBindForeignClassThunk is the bindForeignClassFn the purego backend hands to Wren. purego callbacks can't
+// return structs, so it calls the callback in puregoBindForeignClassFn with the same arguments, which returns a
+// pointer to the WrenForeignClassMethods to bind, and copies those to the memory the caller passed in CX for the
+// result (with the arguments themselves in DX, R8 and R9).
+TEXT wrengoBindForeignClassThunk(SB), NOSPLIT|NOFRAME, $0
+	PUSHQ CX
+	SUBQ $32, SP // Shadow space for the call
+	MOVQ DX, CX
+	MOVQ R8, DX
+	MOVQ R9, R8
+	MOVQ ·puregoBindForeignClassFn(SB), AX
+	CALL AX
+	ADDQ $32, SP
+	POPQ CX
+	MOVQ 0(AX), DX
+	MOVQ DX, 0(CX)
+	MOVQ 8(AX), DX
+	MOVQ DX, 8(CX)
+	MOVQ CX, AX
+	RET
+
+// Wren's foreign methods only receive the VM, so each bound method of a VM gets its own trampoline, which the
+// dispatcher tells apart by the return address of its CALL. WRENGO_TRAMPOLINE must stay the same size (see
+// puregoTrampolineSize()), and there must be puregoForeignTrampolines of them.
+#define WRENGO_TRAMPOLINE CALL wrengoForeignDispatch(SB)
+#define WRENGO_TRAMPOLINES_10 WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE; WRENGO_TRAMPOLINE
+#define WRENGO_TRAMPOLINES_100 WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10; WRENGO_TRAMPOLINES_10
+
+TEXT wrengoForeignTrampolines(SB), NOSPLIT|NOFRAME, $0
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+	WRENGO_TRAMPOLINES_100
+
+// wrengoForeignDispatch calls the callback in puregoCallForeignFn with the VM and the index of the trampoline that
+// called it. It pops the trampoline's return address, so the callback returns straight to Wren.
+TEXT wrengoForeignDispatch(SB), NOSPLIT|NOFRAME, $0
+	POPQ AX
+	LEAQ wrengoForeignTrampolines(SB), R10
+	SUBQ R10, AX // (index + 1) * 5
+	XORL DX, DX
+	MOVQ $5, R10
+	DIVQ R10
+	DECQ AX
+	MOVQ AX, DX
+	MOVQ ·puregoCallForeignFn(SB), AX
+	JMP AX
@@ -0,0 +1,70 @@
+package wrengo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Version is a version of the Wren scripting engine.
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// MinimumVersion is the oldest version of Wren the bindings support; Init refuses to load older libraries.
+var MinimumVersion = Version{Major: 0, Minor: 4, Patch: 0}
+
+// decodeVersion decodes the version number returned from wrenGetVersionNumber(), which is
+// encoded as major * 1000000 + minor * 1000 + patch.
+func decodeVersion(versionNumber int) Version {
+	return Version{
+		Major: versionNumber / 1000000,
+		Minor: (versionNumber / 1000) % 1000,
+		Patch: versionNumber % 1000,
+	}
+}
+
+// Less returns true if the version is older than other.
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// LibraryCapabilities reports the version of the loaded Wren library, and which optional functions it exports.
+type LibraryCapabilities struct {
+	Version Version
+
+	AbortFiber     bool // wrenAbortFiber is available
+	CollectGarbage bool // wrenCollectGarbage is available
+	ForeignClasses bool // wrenSetSlotNewForeign and wrenGetSlotForeign are available
+	UserData       bool // wrenGetUserData and wrenSetUserData are available
+
+	MissingOptional []string // The names of the optional functions the library doesn't export
+}
+
+// MissingSymbolsError is returned when the Wren library doesn't export all of the functions the bindings require.
+type MissingSymbolsError struct {
+	Symbols []string
+}
+
+func (e *MissingSymbolsError) Error() string {
+	return "error: Wren library is missing required functions: " + strings.Join(e.Symbols, ", ")
+}
+
+// VersionError is returned when the Wren library is older than MinimumVersion.
+type VersionError struct {
+	Version Version
+	Minimum Version
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("error: Wren library version %s is older than the minimum supported version %s", e.Version, e.Minimum)
+}
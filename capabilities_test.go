@@ -0,0 +1,28 @@
+package wrengo
+
+import "testing"
+
+func TestDecodeVersion(t *testing.T) {
+
+	tests := []struct {
+		number int
+		want   Version
+	}{
+		{0, Version{0, 0, 0}},
+		{4000, Version{0, 4, 0}},
+		{4001, Version{0, 4, 1}},
+		{1002003, Version{1, 2, 3}},
+		{12345678, Version{12, 345, 678}},
+	}
+
+	for _, test := range tests {
+		if got := decodeVersion(test.number); got != test.want {
+			t.Errorf("decodeVersion(%d) = %v; want %v", test.number, got, test.want)
+		}
+	}
+
+	if !decodeVersion(3999).Less(MinimumVersion) || decodeVersion(4000).Less(MinimumVersion) {
+		t.Errorf("versions before %v should be less than it, and it shouldn't be", MinimumVersion)
+	}
+
+}
@@ -0,0 +1,215 @@
+package wrengo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTooManyAbandonedCalls is returned by RunContext() and CallContext() while as many calls that were given up on
+// are still running as SetMaxAbandonedCalls() allows.
+var ErrTooManyAbandonedCalls = errors.New("error: too many calls that were given up on are still running")
+
+// abandonGrace is how long a call into the VM is given to return once its context is done, before it's given up on.
+// A script that calls into Go is aborted well within it.
+const abandonGrace = 10 * time.Millisecond
+
+// abandonedCalls is the number of calls that were given up on that are still running, across every VM, and
+// maxAbandonedCalls the most there can be before calls with a context are refused (0 meaning no limit).
+var abandonedCalls atomic.Int64
+var maxAbandonedCalls atomic.Int64
+
+func init() {
+	maxAbandonedCalls.Store(int64(runtime.NumCPU()))
+}
+
+// AbandonedCalls returns the number of calls into VMs that were given up on, as their context was done before they
+// returned (see VM.RunContext()), and that are still running. Each of them keeps a thread busy, likely spinning
+// in a loop that never ends, so a program that sees it grow should stop running the scripts responsible, or
+// restart.
+func AbandonedCalls() int {
+	return int(abandonedCalls.Load())
+}
+
+// SetMaxAbandonedCalls sets how many calls that were given up on (see AbandonedCalls()) can be running at once,
+// across every VM; while there are as many, VM.RunContext() and CallHandle.CallContext() return
+// ErrTooManyAbandonedCalls rather than run anything, so runaway scripts can't take over every thread. The default
+// is the number of CPUs; 0 means no limit. SetMaxAbandonedCalls panics if calls is negative.
+func SetMaxAbandonedCalls(calls int) {
+	if calls < 0 {
+		panic(fmt.Errorf("error: invalid maximum number of abandoned calls (%d); it can't be negative", calls))
+	}
+	maxAbandonedCalls.Store(int64(calls))
+}
+
+// RunContext is like Run(), but honors the context: once it's done, the next call the script makes into Go (to a
+// foreign method, or a foreign class's allocator) aborts the fiber, and RunContext returns ctx.Err(). Foreign
+// functions can get the context with VM.Context(), to pass it on. If the VM tracks its memory (see
+// WithMemoryTracking()), its allocator checks the context as well; Wren can't fail an allocation safely, so that
+// only makes RunContext return ctx.Err() once the script returns, even if it doesn't call into Go again.
+//
+// Wren can't be interrupted while it runs without calling into Go, so a script that doesn't (like a runaway
+// "while (true) {}") can't be aborted. Rather than waiting for it, RunContext returns ctx.Err() shortly after the
+// context is done, leaving the script to run in the background. Until it returns, if it ever does, calls into the VM
+// return ErrVMAbandoned rather than wait for it, and Free() frees the VM once it returns. Abandoned calls keep
+// running in the background for as long as they take, so only so many are allowed at once (see
+// SetMaxAbandonedCalls()).
+func (vm *VM) RunContext(ctx context.Context, moduleName, src string) error {
+	return vm.callContext(ctx, func() error {
+		return vm.run(moduleName, src)
+	})
+}
+
+// CallContext is like Call(), but honors the context, as VM.RunContext() does.
+func (w *CallHandle) CallContext(ctx context.Context, args ...any) (any, error) {
+	var res any
+	err := w.vm.callContext(ctx, func() error {
+		var err error
+		res, err = w.call(args)
+		return err
+	})
+	return res, err
+}
+
+// Context returns the context of the running call into the VM (see RunContext()), for foreign functions to honor,
+// or context.Background() if it wasn't given one.
+func (vm *VM) Context() context.Context {
+	if vm.ctx == nil {
+		return context.Background()
+	}
+	return vm.ctx
+}
+
+// contextDone returns the error aborting the fiber if the context of the running call into the VM is done, or nil
+// if it isn't.
+func (vm *VM) contextDone() *RuntimeError {
+	if vm.ctx == nil || vm.ctx.Err() == nil {
+		return nil
+	}
+	return &RuntimeError{Message: vm.ctx.Err().Error(), err: vm.ctx.Err()}
+}
+
+// callContext makes a call into the VM with the context, locking the VM for it. Calls with a context that can be
+// done run on a goroutine of their own, so they can be given up on if the context is done before the call returns.
+func (vm *VM) callContext(ctx context.Context, call func() error) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if max := maxAbandonedCalls.Load(); max > 0 && abandonedCalls.Load() >= max {
+		return ErrTooManyAbandonedCalls
+	}
+
+	unlock, err := vm.lockContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Done() == nil || vm.reentered() {
+		defer unlock()
+		return vm.withContext(ctx, call)
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+
+		defer unlock()
+
+		done <- vm.withContext(ctx, call)
+
+		vm.abandonLock.Lock()
+		abandoned := false
+		select {
+		case <-vm.abandoned:
+			abandoned = true
+			vm.abandoned = make(chan struct{})
+		default:
+		}
+		free := vm.freeLater
+		vm.freeLater = false
+		vm.abandonLock.Unlock()
+
+		if abandoned {
+			vm.failed = true
+			abandonedCalls.Add(-1)
+		}
+		if free && !vm.freed {
+			vm.free()
+		}
+
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	grace := time.NewTimer(abandonGrace)
+	defer grace.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-grace.C:
+	}
+
+	vm.abandonLock.Lock()
+	defer vm.abandonLock.Unlock()
+
+	// The call may have returned in the meantime
+	select {
+	case err := <-done:
+		return err
+	default:
+		close(vm.abandoned)
+		abandonedCalls.Add(1)
+		return ctx.Err()
+	}
+
+}
+
+// withContext runs the call with the context as the VM's context, returning ctx.Err() if the call fails once it's
+// done, or if the VM's allocator found it done while the call ran.
+func (vm *VM) withContext(ctx context.Context, call func() error) error {
+
+	outer, outerDone := vm.ctx, vm.memory.done.Load()
+
+	var done *<-chan struct{}
+	if d := ctx.Done(); d != nil {
+		done = &d
+	}
+
+	vm.ctx = ctx
+	vm.memory.done.Store(done)
+	err := call()
+	vm.ctx = outer
+	vm.memory.done.Store(outerDone)
+
+	interrupted := vm.memory.interrupted.Swap(false)
+
+	if (err != nil || interrupted) && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+
+}
+
+// freeOnReturn makes Free() free the VM once the call into it that was given up on returns, if there's one running,
+// returning false if there isn't.
+func (vm *VM) freeOnReturn() bool {
+	vm.abandonLock.Lock()
+	defer vm.abandonLock.Unlock()
+	select {
+	case <-vm.abandoned:
+		vm.freeLater = true
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,108 @@
+package wrengo
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRunContextAbandonsRunawayCalls(t *testing.T) {
+
+	fake, vm := newFakeVM(t, nil)
+
+	// A script that doesn't call into Go, and so can't be interrupted, until it's let go
+	release := make(chan struct{})
+	returned := make(chan struct{})
+	fake.OnInterpret = func(vm *VM, module, source string) error {
+		if module == "runaway" {
+			<-release
+			close(returned)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := vm.RunContext(ctx, "runaway", ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunContext() returned %v; want context.DeadlineExceeded", err)
+	}
+
+	// Calls into the VM fail straight away until the abandoned call returns
+	if err := vm.Run("other", ""); !errors.Is(err, ErrVMAbandoned) {
+		t.Errorf("Run() returned %v; want ErrVMAbandoned", err)
+	}
+	if err := vm.Free(); !errors.Is(err, ErrVMAbandoned) {
+		t.Errorf("Free() returned %v; want ErrVMAbandoned", err)
+	}
+
+	// Once it returns, the VM is freed, as Free() was called
+	close(release)
+	<-returned
+	deadline := time.Now().Add(time.Second)
+	for vm.Free() != ErrVMFreed {
+		if time.Now().After(deadline) {
+			t.Fatal("the VM wasn't freed once the abandoned call returned")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+}
+
+func TestMaxAbandonedCalls(t *testing.T) {
+
+	SetMaxAbandonedCalls(1)
+	t.Cleanup(func() { SetMaxAbandonedCalls(runtime.NumCPU()) })
+
+	fake, runaway := newFakeVM(t, nil)
+	_, other := newFakeVM(t, nil)
+
+	release := make(chan struct{})
+	fake.OnInterpret = func(vm *VM, module, source string) error {
+		if module == "runaway" {
+			<-release
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := runaway.RunContext(ctx, "runaway", ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunContext() returned %v; want context.DeadlineExceeded", err)
+	}
+	if got := AbandonedCalls(); got != 1 {
+		t.Errorf("AbandonedCalls() = %d; want 1", got)
+	}
+
+	// No more calls can be given up on, so calls with a context are refused, while others still run
+	if err := other.RunContext(context.Background(), "main", ""); !errors.Is(err, ErrTooManyAbandonedCalls) {
+		t.Errorf("RunContext() returned %v; want ErrTooManyAbandonedCalls", err)
+	}
+	if err := other.Run("main", ""); err != nil {
+		t.Errorf("Run() returned %v", err)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for AbandonedCalls() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("AbandonedCalls() didn't go back to 0 once the call returned")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := other.RunContext(context.Background(), "other", ""); err != nil {
+		t.Errorf("RunContext() once the abandoned call returned: %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("SetMaxAbandonedCalls() with a negative number didn't panic")
+		}
+	}()
+	SetMaxAbandonedCalls(-1)
+
+}
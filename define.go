@@ -0,0 +1,272 @@
+package wrengo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ModuleDefinition is a Wren module defined from Go, made of classes whose methods are Go functions. Wren source
+// declaring the classes and their foreign methods is generated for it, so scripts can import it like any other
+// module:
+//
+//	vm.DefineModule("engine").Class("Input").Static("pressed(_)", func(vm *wrengo.VM, args []any) any {
+//		return input.Pressed(args[0].(string))
+//	})
+//
+//	vm.Run("main", `
+//	import "engine" for Input
+//	System.print(Input.pressed("jump"))
+//	`)
+//
+// The module's source is generated when it's first imported, so it must be fully defined by then.
+type ModuleDefinition struct {
+	name    string
+	classes []*ClassDefinition
+	err     error
+}
+
+// ClassDefinition is a class in a ModuleDefinition. Classes with constructors (see Construct()) are foreign classes,
+// whose instances hold Go values.
+type ClassDefinition struct {
+	name         string
+	methods      []methodDefinition
+	constructors []methodDefinition
+	finalize     func(value any)
+}
+
+type methodDefinition struct {
+	signature string
+	isStatic  bool
+	fn        GoForeignFunction
+}
+
+// DefineModule returns the definition of the named module, creating it if it doesn't exist yet. The module is
+// loaded from the definition when it's imported, before the configuration's module loaders are tried.
+//
+// If the VM has been freed, the definition returned isn't added to it, and its Err() method returns ErrVMFreed (or
+// ErrVMAbandoned, if the VM can't be used for the time being).
+func (vm *VM) DefineModule(name string) *ModuleDefinition {
+
+	name = CanonicalModuleName("", name)
+
+	unlock, err := vm.lock()
+	if err != nil {
+		return &ModuleDefinition{name: name, err: err}
+	}
+	defer unlock()
+
+	if vm.freed {
+		return &ModuleDefinition{name: name, err: ErrVMFreed}
+	}
+
+	if vm.modules == nil {
+		vm.modules = map[string]*ModuleDefinition{}
+	}
+
+	module, ok := vm.modules[name]
+	if !ok {
+		module = &ModuleDefinition{name: name}
+		vm.modules[name] = module
+	}
+
+	return module
+
+}
+
+// Err returns ErrVMFreed if the module was defined in a VM that had already been freed (or ErrVMAbandoned; see
+// VM.DefineModule()), so that the definition went nowhere, or nil otherwise.
+func (m *ModuleDefinition) Err() error {
+	return m.err
+}
+
+// Class returns the definition of the named class in the module, adding it if it doesn't exist yet.
+func (m *ModuleDefinition) Class(name string) *ClassDefinition {
+
+	for _, class := range m.classes {
+		if class.name == name {
+			return class
+		}
+	}
+
+	class := &ClassDefinition{name: name}
+	m.classes = append(m.classes, class)
+	return class
+
+}
+
+// Source returns the Wren source generated for the module.
+func (m *ModuleDefinition) Source() string {
+
+	src := strings.Builder{}
+
+	for _, class := range m.classes {
+
+		if len(class.constructors) > 0 {
+			fmt.Fprintf(&src, "foreign class %s {\n", class.name)
+		} else {
+			fmt.Fprintf(&src, "class %s {\n", class.name)
+		}
+
+		for _, constructor := range class.constructors {
+			fmt.Fprintf(&src, "\tconstruct %s {}\n", declaration(constructor.signature))
+		}
+
+		for _, method := range class.methods {
+			if method.isStatic {
+				fmt.Fprintf(&src, "\tforeign static %s\n", declaration(method.signature))
+			} else {
+				fmt.Fprintf(&src, "\tforeign %s\n", declaration(method.signature))
+			}
+		}
+
+		src.WriteString("}\n\n")
+
+	}
+
+	return src.String()
+
+}
+
+// Static adds a static foreign method with the given signature (e.g. "pressed(_)", "count", or "volume=(_)") to the
+// class, calling fn when it's called. It returns the class, so methods can be chained.
+func (c *ClassDefinition) Static(signature string, fn GoForeignFunction) *ClassDefinition {
+	return c.addMethod(signature, true, fn)
+}
+
+// Method adds a foreign instance method with the given signature to the class, calling fn when it's called; for
+// foreign classes, VM.Receiver() returns the Go value of the instance it's called on. It returns the class, so
+// methods can be chained.
+func (c *ClassDefinition) Method(signature string, fn GoForeignFunction) *ClassDefinition {
+	return c.addMethod(signature, false, fn)
+}
+
+func (c *ClassDefinition) addMethod(signature string, isStatic bool, fn GoForeignFunction) *ClassDefinition {
+
+	signature = strings.ReplaceAll(signature, " ", "")
+
+	for i, method := range c.methods {
+		if method.signature == signature && method.isStatic == isStatic {
+			c.methods[i].fn = fn
+			return c
+		}
+	}
+
+	c.methods = append(c.methods, methodDefinition{signature: signature, isStatic: isStatic, fn: fn})
+	return c
+
+}
+
+// Construct adds a constructor with the given signature (e.g. "new(_,_)") to the class, making it a foreign class.
+// When an instance is constructed, fn is called with the constructor's arguments, and the value it returns is the
+// instance's Go value (see ForeignClass). It returns the class, so methods can be chained.
+//
+// Wren doesn't tell Go which constructor is being called, only the arguments passed to it, so a class's
+// constructors must each take a different number of arguments; Construct panics otherwise.
+func (c *ClassDefinition) Construct(signature string, fn GoForeignFunction) *ClassDefinition {
+
+	signature = strings.ReplaceAll(signature, " ", "")
+	argCount := strings.Count(signature, "_")
+
+	for i, constructor := range c.constructors {
+		if constructor.signature == signature {
+			c.constructors[i].fn = fn
+			return c
+		}
+		if strings.Count(constructor.signature, "_") == argCount {
+			panic(fmt.Errorf("error: constructors '%s' and '%s' of class %s take the same number of arguments", constructor.signature, signature, c.name))
+		}
+	}
+
+	c.constructors = append(c.constructors, methodDefinition{signature: signature, fn: fn})
+	return c
+
+}
+
+// Finalize sets a function to be called with the Go value of each of the class's instances once Wren's garbage
+// collector frees it (see ForeignClass). It returns the class, so methods can be chained.
+func (c *ClassDefinition) Finalize(fn func(value any)) *ClassDefinition {
+	c.finalize = fn
+	return c
+}
+
+// foreignClass returns the ForeignClass binding the class to Go, calling the constructor that takes the arguments
+// passed to allocate instances.
+func (c *ClassDefinition) foreignClass() *ForeignClass {
+	return &ForeignClass{
+		Allocate: func(vm *VM, args []any) any {
+			for _, constructor := range c.constructors {
+				if strings.Count(constructor.signature, "_") == len(args) {
+					return constructor.fn(vm, args)
+				}
+			}
+			return nil
+		},
+		Finalize: c.finalize,
+	}
+}
+
+// declaration turns a method signature into the declaration of a method with it, naming each parameter
+// (so "move(_,_)" becomes "move(p0, p1)", and "[_]=(_)" becomes "[p0]=(p1)").
+func declaration(signature string) string {
+
+	decl := strings.Builder{}
+	param := 0
+
+	for i, r := range signature {
+		if r == '_' {
+			fmt.Fprintf(&decl, "p%d", param)
+			param++
+			continue
+		}
+		decl.WriteRune(r)
+		if r == ',' && i < len(signature)-1 {
+			decl.WriteRune(' ')
+		}
+	}
+
+	return decl.String()
+
+}
+
+// definedForeignMethod returns the Go function for the foreign method from the VM's module definitions, or nil if
+// it's not defined in them.
+func (vm *VM) definedForeignMethod(module, className string, isStatic bool, signature string) GoForeignFunction {
+
+	m, ok := vm.modules[module]
+	if !ok {
+		return nil
+	}
+
+	for _, class := range m.classes {
+		if class.name != className {
+			continue
+		}
+		for _, method := range class.methods {
+			if method.signature == signature && method.isStatic == isStatic {
+				return method.fn
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// definedForeignClass returns the ForeignClass for the class from the VM's module definitions, or nil if it's not
+// defined in them (or isn't a foreign class).
+func (vm *VM) definedForeignClass(module, className string) *ForeignClass {
+
+	m, ok := vm.modules[module]
+	if !ok {
+		return nil
+	}
+
+	for _, class := range m.classes {
+		if class.name == className && len(class.constructors) > 0 {
+			return class.foreignClass()
+		}
+	}
+
+	return nil
+
+}
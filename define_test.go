@@ -0,0 +1,92 @@
+package wrengo
+
+import "testing"
+
+func TestDeclaration(t *testing.T) {
+
+	tests := []struct {
+		signature, want string
+	}{
+		{"count", "count"},
+		{"pressed(_)", "pressed(p0)"},
+		{"move(_,_)", "move(p0, p1)"},
+		{"volume=(_)", "volume=(p0)"},
+		{"[_]", "[p0]"},
+		{"[_,_]=(_)", "[p0, p1]=(p2)"},
+		{"-", "-"},
+		{"+(_)", "+(p0)"},
+	}
+
+	for _, test := range tests {
+		if got := declaration(test.signature); got != test.want {
+			t.Errorf("declaration(%q) = %q; want %q", test.signature, got, test.want)
+		}
+	}
+
+}
+
+func TestModuleDefinitionSource(t *testing.T) {
+
+	_, vm := newFakeVM(t, nil)
+
+	noop := func(vm *VM, args []any) any { return nil }
+
+	engine := vm.DefineModule("./engine.wren")
+	engine.Class("Input").
+		Static("pressed(_)", noop).
+		Static("mouse", noop)
+	engine.Class("Audio").
+		Method("play(_, _)", noop).
+		Static("volume=(_)", noop)
+	engine.Class("Input").Static("pressed(_)", noop) // Redefining a method doesn't declare it twice
+
+	want := "class Input {\n" +
+		"\tforeign static pressed(p0)\n" +
+		"\tforeign static mouse\n" +
+		"}\n\n" +
+		"class Audio {\n" +
+		"\tforeign play(p0, p1)\n" +
+		"\tforeign static volume=(p0)\n" +
+		"}\n\n"
+
+	if got := vm.DefineModule("engine").Source(); got != want {
+		t.Errorf("Source() = %q; want %q", got, want)
+	}
+
+}
+
+func TestDefinedModuleDispatch(t *testing.T) {
+
+	fake, vm := newFakeVM(t, func(cfg Config) Config {
+		return cfg.WithForeignMethodResolver(echo(func(args []any) any { return "resolver" }))
+	})
+
+	vm.DefineModule("engine").Class("Input").
+		Static("pressed(_)", func(vm *VM, args []any) any { return args[0] == "jump" }).
+		Method("pressed(_)", func(vm *VM, args []any) any { return "instance" })
+
+	tests := []struct {
+		className, signature string
+		isStatic             bool
+		want                 any
+	}{
+		{"Input", "pressed(_)", true, true},
+		{"Input", "pressed(_)", false, "instance"},
+		{"Input", "released(_)", true, "resolver"}, // Methods that aren't defined are left to the resolver
+		{"Mouse", "pressed(_)", true, "resolver"},
+	}
+
+	for _, test := range tests {
+		got, err := fake.CallForeign(vm, "engine", test.className, test.signature, test.isStatic, "jump")
+		if err != nil || got != test.want {
+			t.Errorf("CallForeign(%q, %q, %t) = %v, %v; want %v", test.className, test.signature, test.isStatic, got, err, test.want)
+		}
+	}
+
+	// The module is loaded from its definition when it's imported
+	v := fake.vm(vm.handle)
+	if got, want := string(v.config.LoadModule(vm.handle, "engine")), vm.DefineModule("engine").Source(); got != want {
+		t.Errorf("the module loaded as %q; want its generated source", got)
+	}
+
+}
@@ -0,0 +1,99 @@
+package wrengo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+var ErrNoEmbeddedLibrary = fmt.Errorf("error: no embedded Wren library for %s/%s", runtime.GOOS, runtime.GOARCH)
+
+// InitEmbedded initializes the Wren-Go bindings using the Wren library embedded in the package for the
+// current platform. This means there's no need to copy the lib directory next to the executable.
+//
+// The library is extracted to a cache directory named after a hash of its contents before being loaded,
+// so it's only written out once for each version of the library (and re-extracted if it was altered).
+func InitEmbedded() error {
+
+	libPath, err := extractEmbeddedLibrary()
+	if err != nil {
+		return err
+	}
+
+	return Init(libPath)
+
+}
+
+// extractEmbeddedLibrary writes the embedded library out to the cache directory if it isn't already
+// there, and returns the path to the extracted file.
+func extractEmbeddedLibrary() (string, error) {
+
+	if len(embeddedLibrary) == 0 {
+		return "", ErrNoEmbeddedLibrary
+	}
+
+	sum := sha256.Sum256(embeddedLibrary)
+
+	baseDir, err := os.UserCacheDir()
+	if err != nil {
+		baseDir = os.TempDir()
+	}
+
+	dir := filepath.Join(baseDir, "wrengo", hex.EncodeToString(sum[:8]))
+	libPath := filepath.Join(dir, embeddedLibraryName)
+
+	if embeddedLibraryExtracted(libPath, sum) {
+		return libPath, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("error extracting embedded Wren library: %w", err)
+	}
+
+	// Write to a temporary file first and then rename it into place, so other processes
+	// extracting the library at the same time never see a partially written file.
+	tmp, err := os.CreateTemp(dir, embeddedLibraryName+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("error extracting embedded Wren library: %w", err)
+	}
+
+	_, err = tmp.Write(embeddedLibrary)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o755)
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), libPath)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		// Another process may have won the race (or have the library open, on Windows).
+		if embeddedLibraryExtracted(libPath, sum) {
+			return libPath, nil
+		}
+		return "", fmt.Errorf("error extracting embedded Wren library: %w", err)
+	}
+
+	return libPath, nil
+
+}
+
+// embeddedLibraryExtracted returns true if the file at libPath exists and matches the embedded library.
+func embeddedLibraryExtracted(libPath string, sum [sha256.Size]byte) bool {
+
+	existing, err := os.ReadFile(libPath)
+	if err != nil {
+		return false
+	}
+
+	return sha256.Sum256(existing) == sum
+
+}
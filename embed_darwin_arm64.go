@@ -0,0 +1,8 @@
+package wrengo
+
+import _ "embed"
+
+//go:embed lib/wren_macos_arm_64.dylib
+var embeddedLibrary []byte
+
+const embeddedLibraryName = "wren_macos_arm_64.dylib"
@@ -0,0 +1,8 @@
+package wrengo
+
+import _ "embed"
+
+//go:embed lib/wren_linux_x86_64.so
+var embeddedLibrary []byte
+
+const embeddedLibraryName = "wren_linux_x86_64.so"
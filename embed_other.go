@@ -0,0 +1,8 @@
+//go:build !((linux && amd64) || (darwin && (amd64 || arm64)) || (windows && (386 || amd64)))
+
+package wrengo
+
+// No library is shipped for this platform; InitEmbedded will return ErrNoEmbeddedLibrary.
+var embeddedLibrary []byte
+
+const embeddedLibraryName = ""
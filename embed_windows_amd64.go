@@ -0,0 +1,8 @@
+package wrengo
+
+import _ "embed"
+
+//go:embed lib/wren_win_x86_64.dll
+var embeddedLibrary []byte
+
+const embeddedLibraryName = "wren_win_x86_64.dll"
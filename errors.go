@@ -0,0 +1,206 @@
+package wrengo
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The error types Wren reports through its error callback.
+const (
+	errorTypeCompile    = 0 // WREN_ERROR_COMPILE
+	errorTypeRuntime    = 1 // WREN_ERROR_RUNTIME
+	errorTypeStackTrace = 2 // WREN_ERROR_STACK_TRACE
+)
+
+// Diagnostic is a single compile error reported by Wren.
+type Diagnostic struct {
+	Module  string
+	Line    int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s", d.Module, d.Line, d.Message)
+}
+
+// CompileError is returned when Wren code fails to compile. It holds every diagnostic Wren reported, in order.
+// CompileErrors match ErrCompileTime with errors.Is().
+type CompileError struct {
+	Module      string // The module being compiled
+	Diagnostics []Diagnostic
+}
+
+func (e *CompileError) Error() string {
+	if len(e.Diagnostics) == 0 {
+		return fmt.Sprintf("%s: %s", e.Module, ErrCompileTime)
+	}
+	msg := fmt.Sprintf("%s: %s", ErrCompileTime, e.Diagnostics[0])
+	if len(e.Diagnostics) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(e.Diagnostics)-1)
+	}
+	return msg
+}
+
+func (e *CompileError) Unwrap() error {
+	return ErrCompileTime
+}
+
+// StackFrame is a single line of a runtime error's stack trace, from the innermost call outwards.
+type StackFrame struct {
+	Module   string
+	Line     int
+	Function string
+}
+
+func (f StackFrame) String() string {
+	return fmt.Sprintf("%s:%d in %s", f.Module, f.Line, f.Function)
+}
+
+// RuntimeError is returned when a fiber aborts while running Wren code, whether from a runtime error in the script
+// or from Fiber.abort().
+type RuntimeError struct {
+	Message string
+	Stack   []StackFrame
+
+	err error // The Go error the fiber was aborted for, if any (e.g. ErrMemoryLimit)
+}
+
+func (e *RuntimeError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = "runtime error"
+	}
+	if len(e.Stack) > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.Stack[0].Module, e.Stack[0].Line, msg)
+	}
+	return msg
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.err
+}
+
+// WithErrorHandler sets a function to be called with each error a VM returns from running code (a *CompileError
+// or *RuntimeError), in addition to the error being returned from Run(), RunFile() or CallHandle.Call().
+// NewConfig() sets a handler that prints errors along with the script's output, to the Writer set with WithWriter()
+// (os.Stdout by default); passing nil removes it.
+func (cfg Config) WithErrorHandler(handler func(vm *VM, err error)) Config {
+	cfg.errorHandler = handler
+	return cfg
+}
+
+// printError is the default error handler, printing errors the way Wren's own CLI does, to the VM's Writer.
+func printError(vm *VM, err error) {
+
+	var text strings.Builder
+
+	switch e := err.(type) {
+	case *CompileError:
+		for _, d := range e.Diagnostics {
+			fmt.Fprintf(&text, "[%s:%d] Compile %s\n", d.Module, d.Line, d.Message)
+		}
+	case *RuntimeError:
+		fmt.Fprintf(&text, "[Runtime Error] %s\n", e.Message)
+		for _, frame := range e.Stack {
+			fmt.Fprintf(&text, "[%s:%d] in %s\n", frame.Module, frame.Line, frame.Function)
+		}
+	}
+
+	if vm.output == nil {
+		os.Stdout.WriteString(text.String())
+		return
+	}
+	vm.output.write(text.String())
+
+}
+
+// errorCollector collects the errors Wren reports while running code, for a single call into the VM.
+type errorCollector struct {
+	diagnostics []Diagnostic
+	runtime     *RuntimeError
+}
+
+func (c *errorCollector) report(errorType int, module string, line int, message string) {
+	switch errorType {
+	case errorTypeCompile:
+		c.diagnostics = append(c.diagnostics, Diagnostic{Module: module, Line: line, Message: message})
+	case errorTypeRuntime:
+		c.runtime = &RuntimeError{Message: message}
+	case errorTypeStackTrace:
+		if c.runtime == nil {
+			c.runtime = &RuntimeError{}
+		}
+		c.runtime.Stack = append(c.runtime.Stack, StackFrame{Module: module, Line: line, Function: message})
+	}
+}
+
+// reportError is called from Wren's error callback.
+func (vm *VM) reportError(errorType int, module string, line int, message string) {
+	if vm.errs != nil {
+		vm.errs.report(errorType, module, line, message)
+	}
+}
+
+// collectErrors starts collecting the errors Wren reports while running code in the given module. The returned
+// function stops collecting, and turns the result of the interpretation or call into the error to return (calling
+// the error handler if there is one). Calls nest, each collecting its own errors.
+func (vm *VM) collectErrors(module string) func(result int) error {
+
+	outer := vm.errs
+	collector := &errorCollector{}
+	vm.errs = collector
+
+	return func(result int) error {
+
+		vm.errs = outer
+
+		aborted := vm.aborted
+		vm.aborted = nil
+
+		var err error
+
+		switch {
+		case result == 1: // WREN_RESULT_COMPILE_ERROR
+			err = &CompileError{Module: module, Diagnostics: collector.diagnostics}
+		case result != 0: // WREN_RESULT_RUNTIME_ERROR
+			runtimeErr := collector.runtime
+			if runtimeErr == nil {
+				runtimeErr = &RuntimeError{}
+			}
+			if aborted != nil {
+				runtimeErr.err = aborted.err
+			}
+			err = runtimeErr
+		case aborted != nil:
+			// The fiber should have been aborted, but the library can't
+			err = aborted
+		case vm.memoryLimitExceeded():
+			err = vm.memoryLimitError()
+		default:
+			return nil
+		}
+
+		if _, ok := err.(*CompileError); !ok {
+			vm.failed = true
+		}
+
+		if vm.config.errorHandler != nil {
+			vm.callBack(func() { vm.config.errorHandler(vm, err) })
+		}
+
+		return err
+
+	}
+
+}
+
+// abortFiber aborts the fiber that called the running foreign method, so that Run() or CallHandle.Call() returns
+// the given error.
+func (vm *VM) abortFiber(handle uintptr, err *RuntimeError) {
+	vm.aborted = err
+	if vm.lib.capabilities.AbortFiber {
+		vm.lib.backend.SetSlotString(handle, 0, err.Message)
+		vm.lib.backend.AbortFiber(handle, 0)
+	}
+}
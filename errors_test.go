@@ -0,0 +1,137 @@
+package wrengo
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompileError(t *testing.T) {
+
+	_, vm := newFakeVM(t, nil)
+
+	done := vm.collectErrors("main")
+	vm.reportError(errorTypeCompile, "main", 1, "Error at 'x': Expected expression.")
+	vm.reportError(errorTypeCompile, "main", 3, "Error at end of file: Expected '}'.")
+	err := done(1)
+
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) {
+		t.Fatalf("got %v; want a *CompileError", err)
+	}
+	if !errors.Is(err, ErrCompileTime) {
+		t.Error("the CompileError doesn't match ErrCompileTime")
+	}
+
+	want := []Diagnostic{
+		{Module: "main", Line: 1, Message: "Error at 'x': Expected expression."},
+		{Module: "main", Line: 3, Message: "Error at end of file: Expected '}'."},
+	}
+	if !reflect.DeepEqual(compileErr.Diagnostics, want) {
+		t.Errorf("Diagnostics = %v; want %v", compileErr.Diagnostics, want)
+	}
+
+	if got, want := err.Error(), "error compiling wren script: main:1: Error at 'x': Expected expression. (and 1 more)"; got != want {
+		t.Errorf("Error() = %q; want %q", got, want)
+	}
+
+}
+
+func TestRuntimeError(t *testing.T) {
+
+	_, vm := newFakeVM(t, nil)
+
+	done := vm.collectErrors("main")
+	vm.reportError(errorTypeRuntime, "", 0, "Null does not implement 'x'.")
+	vm.reportError(errorTypeStackTrace, "util", 4, "helper(_)")
+	vm.reportError(errorTypeStackTrace, "main", 9, "(script)")
+	err := done(2)
+
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("got %v; want a *RuntimeError", err)
+	}
+
+	want := []StackFrame{
+		{Module: "util", Line: 4, Function: "helper(_)"},
+		{Module: "main", Line: 9, Function: "(script)"},
+	}
+	if !reflect.DeepEqual(runtimeErr.Stack, want) {
+		t.Errorf("Stack = %v; want %v", runtimeErr.Stack, want)
+	}
+
+	if got, want := err.Error(), "util:4: Null does not implement 'x'."; got != want {
+		t.Errorf("Error() = %q; want %q", got, want)
+	}
+
+}
+
+func TestCollectErrorsNests(t *testing.T) {
+
+	_, vm := newFakeVM(t, nil)
+
+	outer := vm.collectErrors("main")
+	vm.reportError(errorTypeRuntime, "", 0, "outer")
+
+	// As when Go code called from Wren calls back into the VM
+	inner := vm.collectErrors("other")
+	vm.reportError(errorTypeRuntime, "", 0, "inner")
+	if err := inner(2); err == nil || err.Error() != "inner" {
+		t.Errorf("the inner call returned %v; want its own error", err)
+	}
+
+	if err := outer(2); err == nil || err.Error() != "outer" {
+		t.Errorf("the outer call returned %v; want its own error", err)
+	}
+
+	if err := vm.collectErrors("main")(0); err != nil {
+		t.Errorf("a successful call returned %v", err)
+	}
+
+}
+
+func TestErrorHandler(t *testing.T) {
+
+	var handled []error
+
+	fake, vm := newFakeVM(t, func(cfg Config) Config {
+		return cfg.WithErrorHandler(func(vm *VM, err error) { handled = append(handled, err) })
+	})
+
+	fake.OnInterpret = func(vm *VM, module, source string) error {
+		return errors.New("aborted")
+	}
+
+	err := vm.Run("main", "")
+
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Message != "aborted" {
+		t.Fatalf("Run() returned %v; want a *RuntimeError", err)
+	}
+	if len(handled) != 1 || handled[0] != err {
+		t.Errorf("the error handler got %v; want the error Run() returned", handled)
+	}
+
+}
+
+func TestPrintErrorUsesWriter(t *testing.T) {
+
+	out := &bytes.Buffer{}
+	fake, vm := newFakeVM(t, func(cfg Config) Config {
+		return cfg.WithWriter(out).WithErrorHandler(printError)
+	})
+
+	fake.OnInterpret = func(vm *VM, module, source string) error {
+		fakePrint(fake, vm, "before\n")
+		return errors.New("aborted")
+	}
+
+	vm.Run("main", "")
+
+	// Errors are printed along with the script's output, in order
+	if want := "before\n[Runtime Error] aborted\n"; out.String() != want {
+		t.Errorf("wrote %q; want %q", out.String(), want)
+	}
+
+}
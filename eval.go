@@ -0,0 +1,67 @@
+package wrengo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// evalVariable is the module variable Eval() stores the value of the expression in, to read it from Go. Scripts
+// mustn't use it themselves.
+const evalVariable = "wrengoEval_"
+
+// Eval evaluates a Wren expression in the scope of a module that's already been run, so the expression can use the
+// module's variables (and whatever it imports), and returns its value converted to Go, as Variable() does:
+//
+//	area, err := vm.Eval("main", "Circle.new(radius).area")
+//
+// Only a single expression on a single line, without "//" comments, is accepted; statements (like "var x = 1") fail
+// to compile, and Eval returns an error for expressions spanning several lines, as Wren separates statements with
+// them. The value is handed over through a module variable named "wrengoEval_",
+// which the first expression evaluated in a module defines in it, and which is set back to null afterwards; it's
+// reserved, so scripts shouldn't define or use a variable of that name. Eval doesn't add a module to the VM. If the
+// expression fails to compile, Eval returns a *CompileError; if it aborts while running, a *RuntimeError.
+func (vm *VM) Eval(module, expr string) (any, error) {
+
+	unlock, err := vm.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if vm.freed {
+		return nil, ErrVMFreed
+	}
+
+	// A line break would let the expression end the assignment, and run statements of its own after it
+	if strings.ContainsAny(expr, "\r\n") {
+		return nil, fmt.Errorf("error evaluating an expression; it must be on a single line")
+	}
+
+	module = CanonicalModuleName("", module)
+
+	if !vm.lib.backend.HasModule(vm.handle, module) {
+		return nil, fmt.Errorf("error evaluating an expression in '%s'; does the module exist?", module)
+	}
+
+	// The parentheses keep the source to a single expression
+	src := evalVariable + " = (" + expr + ")"
+	if !vm.lib.backend.HasVariable(vm.handle, module, evalVariable) {
+		src = "var " + src
+	}
+
+	if err := vm.run(module, src); err != nil {
+		return nil, err
+	}
+
+	vm.lib.backend.EnsureSlots(vm.handle, 100)
+	vm.lib.backend.GetVariable(vm.handle, module, evalVariable, 99)
+	value := vm.lib.slotValueToGo(vm.handle, 99)
+
+	// Don't keep the value alive in the VM
+	if err := vm.run(module, evalVariable+" = null"); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+
+}
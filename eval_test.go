@@ -0,0 +1,105 @@
+package wrengo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeEvaluator makes the FakeBackend evaluate the expressions in values (to the values they map to) when Eval()
+// runs them, recording the source of each module run.
+func fakeEvaluator(fake *FakeBackend, values map[string]any, sources *[]string) {
+
+	fake.OnInterpret = func(vm *VM, module, source string) error {
+
+		*sources = append(*sources, source)
+
+		assignment, ok := strings.CutPrefix(strings.TrimPrefix(source, "var "), evalVariable+" = ")
+		if !ok {
+			return nil
+		}
+
+		if expr, ok := strings.CutPrefix(assignment, "("); ok {
+			assignment = strings.TrimSuffix(expr, ")")
+		}
+
+		value, ok := values[assignment]
+		if !ok && assignment != "null" {
+			return fmt.Errorf("can't evaluate %s", assignment)
+		}
+
+		converted, _ := goToFake(value)
+		fake.vm(vm.handle).module(module)[evalVariable] = converted
+		return nil
+
+	}
+
+}
+
+func TestEval(t *testing.T) {
+
+	fake, vm := newFakeVM(t, nil)
+
+	var sources []string
+	fakeEvaluator(fake, map[string]any{
+		"radius * 2":  4.0,
+		"[1, radius]": []any{1.0, 2.0},
+	}, &sources)
+
+	if err := vm.Run("main", "var radius = 2"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		want any
+	}{
+		{"radius * 2", 4.0},
+		{"[1, radius]", []any{1.0, 2.0}},
+	}
+
+	for _, test := range tests {
+		if got, err := vm.Eval("./main.wren", test.expr); err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Eval(%q) = %v, %v; want %v", test.expr, got, err, test.want)
+		}
+	}
+
+	want := []string{
+		"var radius = 2",
+		"var " + evalVariable + " = (radius * 2)", // The first expression defines the variable
+		evalVariable + " = null",                  // Which is set back to null once it's read
+		evalVariable + " = ([1, radius])",
+		evalVariable + " = null",
+	}
+	if !reflect.DeepEqual(sources, want) {
+		t.Errorf("ran %q; want %q", sources, want)
+	}
+
+	var runtimeErr *RuntimeError
+	if _, err := vm.Eval("main", "nope"); !errors.As(err, &runtimeErr) {
+		t.Errorf("Eval() of an expression that fails returned %v; want a *RuntimeError", err)
+	}
+
+	// Expressions can't break the line to run statements after the assignment
+	for _, expr := range []string{"1)\nSystem.print(\"injected\")\nvar injected = (2", "1)\rvar injected = (2"} {
+		before := len(sources)
+		if _, err := vm.Eval("main", expr); err == nil {
+			t.Errorf("Eval(%q) didn't fail", expr)
+		}
+		if len(sources) != before {
+			t.Errorf("Eval(%q) ran %q", expr, sources[before:])
+		}
+	}
+
+	if _, err := vm.Eval("missing", "1"); err == nil {
+		t.Error("Eval() in a missing module didn't fail")
+	}
+
+	vm.Free()
+	if _, err := vm.Eval("main", "radius * 2"); !errors.Is(err, ErrVMFreed) {
+		t.Errorf("Eval() in a freed VM returned %v; want ErrVMFreed", err)
+	}
+
+}
@@ -9,7 +9,7 @@ import (
 
 func main() {
 
-	err := wrengo.InitFromDirectory("./lib")
+	err := wrengo.InitEmbedded()
 	if err != nil {
 		panic(err)
 	}
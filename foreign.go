@@ -0,0 +1,161 @@
+package wrengo
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// ForeignClass binds a foreign class declared in Wren to Go, so that each instance of the class holds a Go value
+// (for example, a sprite or a physics body). The value is created by Allocate when the instance is constructed,
+// kept alive for as long as the instance is, and released once Wren's garbage collector frees the instance:
+//
+//	foreign class Sprite {
+//		construct new(image) {}
+//		foreign x
+//	}
+//
+// The class's foreign methods can get the instance's value with VM.Receiver(), and it's what VM.Variable() and
+// CallHandle.Call() return for the instance as well.
+type ForeignClass struct {
+	// Allocate is called with the arguments passed to the constructor, before the constructor's body runs, and
+	// returns the instance's Go value.
+	Allocate GoForeignFunction
+	// Finalize, if set, is called with the instance's value once the instance has been freed. It's called during
+	// garbage collection (or when the VM is freed), so it must not call into the VM.
+	Finalize func(value any)
+}
+
+// WithForeignClassResolver sets a function that returns the ForeignClass for each foreign class declared by the
+// VM's scripts, or nil if it's not bound to Go. Classes defined with VM.DefineModule() don't need it.
+//
+// A script constructing an instance of a foreign class that isn't bound to Go aborts with a runtime error.
+// Foreign classes need the wrenSetSlotNewForeign() and wrenGetSlotForeign() functions (see
+// LibraryCapabilities.ForeignClasses); without them, foreign classes aren't bound at all.
+func (cfg Config) WithForeignClassResolver(resolver func(vm *VM, module, className string) *ForeignClass) Config {
+	cfg.bindForeignClassFn = resolver
+	return cfg
+}
+
+// Receiver returns the Go value of the foreign object a foreign method was called on (see ForeignClass), or nil
+// if it wasn't called on one (for example, because it's a static method). It's only meaningful while the
+// foreign method runs.
+func (vm *VM) Receiver() any {
+	return vm.receiver
+}
+
+// foreignMagic marks the data of the foreign objects created by wrengo, as opposed to other foreign objects
+// (such as those of Wren's optional random module).
+const foreignMagic uint64 = 0x6f676e657277 // "wrengo"
+
+// foreignData is the data of a foreign object created by wrengo: the ID of its Go value in foreignValues.
+type foreignData struct {
+	magic uint64
+	id    uint64
+}
+
+// foreignValue is the Go value of a foreign object, kept alive until Wren frees the object.
+type foreignValue struct {
+	value    any
+	finalize func(value any)
+}
+
+// foreignValues holds the Go values of the foreign objects alive in every VM, by ID. Wren finalizes foreign
+// objects from their data alone, so the table is shared by every VM rather than being kept in each.
+var foreignValues = map[uint64]foreignValue{}
+var foreignValuesLock sync.Mutex
+var nextForeignID uint64
+
+// foreignAllocator returns the function that allocates instances of the foreign class, for the Backend to
+// call as the class's allocator.
+func (vm *VM) foreignAllocator(class *ForeignClass) func(handle uintptr) {
+
+	return vm.weakCallback(func(vm *VM, handle uintptr) {
+
+		if vm.memoryLimitExceeded() {
+			vm.abortFiber(handle, vm.memoryLimitError())
+			return
+		}
+
+		if err := vm.contextDone(); err != nil {
+			vm.abortFiber(handle, err)
+			return
+		}
+
+		args := []any{}
+
+		for i := 1; i < vm.lib.backend.GetSlotCount(handle); i++ {
+			args = append(args, vm.lib.slotValueToGo(handle, i))
+		}
+
+		var value any
+		vm.callBack(func() { value = class.Allocate(vm, args) })
+
+		data := vm.lib.backend.SetSlotNewForeign(handle, 0, 0, unsafe.Sizeof(foreignData{}))
+		if data == 0 {
+			return
+		}
+
+		foreignValuesLock.Lock()
+		nextForeignID++
+		id := nextForeignID
+		foreignValues[id] = foreignValue{value: value, finalize: class.Finalize}
+		foreignValuesLock.Unlock()
+
+		*(*foreignData)(cPointer(data)) = foreignData{magic: foreignMagic, id: id}
+
+	})
+
+}
+
+// missingForeignAllocator returns an allocator for a foreign class that isn't bound to Go, which aborts the
+// fiber rather than leaving Wren without an allocator to call.
+func (vm *VM) missingForeignAllocator(module, className string) func(handle uintptr) {
+	return vm.weakCallback(func(vm *VM, handle uintptr) {
+		vm.abortFiber(handle, &RuntimeError{
+			Message: fmt.Sprintf("Foreign class %s in module '%s' is not bound to Go.", className, module),
+		})
+	})
+}
+
+// finalizeForeign releases the Go value of a foreign object that Wren has freed.
+func finalizeForeign(data uintptr) {
+
+	d := (*foreignData)(cPointer(data))
+	if d.magic != foreignMagic {
+		return
+	}
+
+	foreignValuesLock.Lock()
+	value, ok := foreignValues[d.id]
+	delete(foreignValues, d.id)
+	foreignValuesLock.Unlock()
+
+	if ok && value.finalize != nil {
+		value.finalize(value.value)
+	}
+
+}
+
+// foreignSlotValue returns the Go value of the foreign object in the slot, or nil if it wasn't created by wrengo.
+func (lib *Library) foreignSlotValue(vm uintptr, slot int) any {
+
+	if !lib.capabilities.ForeignClasses {
+		return nil
+	}
+
+	data := lib.backend.GetSlotForeign(vm, slot)
+	if data == 0 {
+		return nil
+	}
+
+	d := (*foreignData)(cPointer(data))
+	if d.magic != foreignMagic {
+		return nil
+	}
+
+	foreignValuesLock.Lock()
+	defer foreignValuesLock.Unlock()
+	return foreignValues[d.id].value
+
+}
@@ -0,0 +1,14 @@
+#!/bin/sh
+# Fetches Wren 0.4.0 and writes its amalgamated sources and license to this directory (see README.md).
+set -e
+
+version=0.4.0
+dir=$(cd "$(dirname "$0")" && pwd)
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+git clone --quiet --depth 1 --branch "$version" https://github.com/wren-lang/wren.git "$tmp/wren"
+cd "$tmp/wren"
+python3 util/generate_amalgamation.py > "$dir/wren.c"
+cp src/include/wren.h "$dir/wren.h"
+cp LICENSE "$dir/LICENSE"
@@ -0,0 +1,117 @@
+package wrengo
+
+import (
+	"cmp"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Leak is a VM or CallHandle created while leak tracking was on (see TrackLeaks()) that hasn't been freed or
+// released.
+type Leak struct {
+	Kind  string // "VM" or "CallHandle"
+	Stack string // The stack trace of the goroutine that created it, at the time
+	// Collected is true if it has since become unreachable, and was freed or released automatically.
+	Collected bool
+
+	id uint64
+}
+
+func (l Leak) String() string {
+	if l.Collected {
+		return fmt.Sprintf("%s (collected) created at:\n%s", l.Kind, l.Stack)
+	}
+	return fmt.Sprintf("%s created at:\n%s", l.Kind, l.Stack)
+}
+
+// leakTracker records the VMs and CallHandles created while leak tracking is on, until they're freed or released.
+type leakTracker struct {
+	enabled atomic.Bool
+
+	mu      sync.Mutex
+	nextID  uint64
+	objects map[uint64]*Leak
+}
+
+var leaks = leakTracker{objects: map[uint64]*Leak{}}
+
+// TrackLeaks turns leak tracking on or off. While it's on, the stack trace of each VM and CallHandle created is
+// recorded, until it's freed or released, so that those that never are can be reported by Leaks(). Recording the
+// stack traces is slow, so it's meant for debugging and tests:
+//
+//	func TestScripts(t *testing.T) {
+//		wrengo.TrackLeaks(true)
+//		defer wrengo.TrackLeaks(false)
+//		...
+//		for _, leak := range wrengo.Leaks() {
+//			t.Error(leak)
+//		}
+//	}
+func TrackLeaks(enabled bool) {
+	leaks.enabled.Store(enabled)
+}
+
+// Leaks returns the VMs and CallHandles created while leak tracking was on (see TrackLeaks()) that haven't been
+// freed or released, in the order they were created. This includes those that were freed or released automatically
+// once they became unreachable, as they were still leaked until the garbage collector found them.
+func Leaks() []Leak {
+
+	leaks.mu.Lock()
+	defer leaks.mu.Unlock()
+
+	out := make([]Leak, 0, len(leaks.objects))
+	for _, leak := range leaks.objects {
+		out = append(out, *leak)
+	}
+
+	slices.SortFunc(out, func(a, b Leak) int {
+		return cmp.Compare(a.id, b.id)
+	})
+
+	return out
+
+}
+
+// track starts tracking a new object of the given kind if leak tracking is on, returning its ID, or 0 if it's not
+// tracked.
+func (t *leakTracker) track(kind string) uint64 {
+
+	if !t.enabled.Load() {
+		return 0
+	}
+
+	stack := string(debug.Stack())
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextID++
+	t.objects[t.nextID] = &Leak{Kind: kind, Stack: stack, id: t.nextID}
+	return t.nextID
+
+}
+
+// untrack stops tracking an object that has been freed or released.
+func (t *leakTracker) untrack(id uint64) {
+	if id == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.objects, id)
+}
+
+// collected marks a tracked object as freed or released automatically.
+func (t *leakTracker) collected(id uint64) {
+	if id == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if leak, ok := t.objects[id]; ok {
+		leak.Collected = true
+	}
+}
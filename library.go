@@ -0,0 +1,327 @@
+package wrengo
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"weak"
+)
+
+var ErrLibraryClosed = errors.New("error: library already closed")
+
+// ErrNotInitialized is returned when the package-level functions are used before the bindings have been initialized
+// with Init() or one of its variants. Like the other errors returned for using the bindings in the wrong order (see
+// ErrVMFreed), it's returned by every function that returns an error; NewVM(), which doesn't, panics with it
+// instead (use CreateVM() to get it as an error), and the functions that only report something (such as
+// Capabilities()) return zero values.
+var ErrNotInitialized = errors.New("error: wrengo isn't initialized; call Init() first")
+
+// Library is a loaded Wren library, along with the Backend used to call into it.
+// Each Library is independent, so one process can load several builds of Wren side by side (for example,
+// stock Wren and a patched fork) and create VMs from each of them.
+type Library struct {
+	backend      Backend
+	path         string
+	capabilities LibraryCapabilities
+
+	mu      sync.Mutex
+	vmCount int
+	closing bool
+	closed  bool
+}
+
+// defaultLibrary is the Library loaded by Init(); the package-level functions use it. It's nil if the bindings
+// haven't been initialized (or the library has been closed since).
+var defaultLibrary atomic.Pointer[Library]
+
+// Load loads the Wren shared library at the given filepath and binds the Wren C API functions from it.
+// The path is, by default, relative to the executable, in the current working directory.
+func Load(libraryPath string) (*Library, error) {
+
+	handle, err := loadLibrary(libraryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadFromHandle(handle, libraryPath)
+
+}
+
+// LoadFromDirectory loads the Wren shared library for the current platform, searching the same locations
+// InitFromDirectory() does.
+func LoadFromDirectory(libraryBaseDirectoryPath string) (*Library, error) {
+
+	handle, libPath, err := loadLibraryFromSearchPath(libraryBaseDirectoryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadFromHandle(handle, libPath)
+
+}
+
+func loadFromHandle(handle uintptr, libPath string) (*Library, error) {
+
+	backend, err := newPuregoBackend(handle)
+	if err != nil {
+		closeLibrary(handle)
+		return nil, err
+	}
+
+	return newLibrary(backend, libPath)
+
+}
+
+// Init initializes the Wren-Go bindings using the passed shared library filepath.
+// The path is, by default, relative to the executable, in the current working directory.
+// To search for the library in the usual places instead, use InitFromDirectory().
+//
+// The loaded library is used by the package-level functions (NewConfig(), NewVM(), and so on); to use
+// several libraries at once, use Load() instead.
+func Init(libraryPath string) error {
+
+	lib, err := Load(libraryPath)
+	if err != nil {
+		return err
+	}
+
+	defaultLibrary.Store(lib)
+	return nil
+
+}
+
+// InitFromDirectory initializes the scripting bindings, searching for the correct library for the current
+// platform. The following locations are tried, in order:
+//
+// 1. The given directory (if it's not empty).
+//
+// 2. The file or directories set in the WRENGO_LIB_PATH environment variable.
+//
+// 3. The executable's directory, and the lib directory next to it.
+//
+// 4. The current working directory, and the lib directory in it.
+//
+// 5. The system library paths, using the usual names for a system-wide install (e.g. libwren.so).
+//
+// Libraries named after the platform (e.g. "wren_linux_x86_64.so" or "wren_macos_arm_64.dylib") are looked
+// for in each directory; see LibraryFileNames() for the accepted names. If no library could be loaded, the
+// returned error is a *LibraryNotFoundError listing every path tried and why it failed.
+func InitFromDirectory(libraryBaseDirectoryPath string) error {
+
+	if defaultLibrary.Load() != nil {
+		return nil
+	}
+
+	lib, err := LoadFromDirectory(libraryBaseDirectoryPath)
+	if err != nil {
+		return err
+	}
+
+	defaultLibrary.Store(lib)
+	return nil
+}
+
+// DefaultLibrary returns the Library loaded by Init(), or nil if the bindings haven't been initialized.
+func DefaultLibrary() *Library {
+	return defaultLibrary.Load()
+}
+
+// newLibrary creates a Library using the given backend, checking that its version of Wren is supported.
+func newLibrary(backend Backend, libPath string) (*Library, error) {
+
+	version := decodeVersion(backend.VersionNumber())
+	if version.Less(MinimumVersion) {
+		backend.Close()
+		return nil, &VersionError{Version: version, Minimum: MinimumVersion}
+	}
+
+	lib := &Library{
+		backend: backend,
+		path:    libPath,
+		capabilities: LibraryCapabilities{
+			Version:        version,
+			AbortFiber:     backend.HasFunction("wrenAbortFiber"),
+			CollectGarbage: backend.HasFunction("wrenCollectGarbage"),
+			ForeignClasses: backend.HasFunction("wrenSetSlotNewForeign") && backend.HasFunction("wrenGetSlotForeign"),
+			UserData:       backend.HasFunction("wrenGetUserData") && backend.HasFunction("wrenSetUserData"),
+		},
+	}
+
+	for _, name := range optionalFunctions {
+		if !backend.HasFunction(name) {
+			lib.capabilities.MissingOptional = append(lib.capabilities.MissingOptional, name)
+		}
+	}
+
+	return lib, nil
+
+}
+
+// optionalFunctions are the Wren C API functions the bindings use if they're available, but can do without.
+var optionalFunctions = []string{
+	"wrenAbortFiber",
+	"wrenCollectGarbage",
+	"wrenSetSlotNewForeign",
+	"wrenGetSlotForeign",
+	"wrenSetSlotHandle",
+	"wrenGetUserData",
+	"wrenSetUserData",
+}
+
+// Path returns the filepath the library was loaded from, or an empty string if it wasn't loaded from a file.
+func (lib *Library) Path() string {
+	return lib.path
+}
+
+// Backend returns the Backend the library uses to call into Wren.
+func (lib *Library) Backend() Backend {
+	return lib.backend
+}
+
+// Capabilities returns a report of the library's version and the optional functions it supports.
+func (lib *Library) Capabilities() LibraryCapabilities {
+	return lib.capabilities
+}
+
+// VersionNumber returns the version number of the library, as major, minor, and patch numbers.
+func (lib *Library) VersionNumber() (int, int, int) {
+	v := lib.capabilities.Version
+	return v.Major, v.Minor, v.Patch
+}
+
+// NewConfig creates a new configuration for creating a VM from this library.
+func (lib *Library) NewConfig() Config {
+	return Config{}.withDefaultCallbacks()
+}
+
+// NewVM creates a new VM from this library using the provided configuration.
+// NewVM panics with ErrLibraryClosed if the library has been closed; CreateVM() returns it instead.
+func (lib *Library) NewVM(config Config) *VM {
+	vm, err := lib.CreateVM(config)
+	if err != nil {
+		panic(err)
+	}
+	return vm
+}
+
+// CreateVM is like NewVM(), but returns ErrLibraryClosed if the library has been closed, rather than panicking.
+func (lib *Library) CreateVM(config Config) (*VM, error) {
+
+	lib.mu.Lock()
+	if lib.closing {
+		lib.mu.Unlock()
+		return nil, ErrLibraryClosed
+	}
+	lib.vmCount++
+	lib.mu.Unlock()
+
+	vm := &VM{
+		lib:       lib,
+		config:    config,
+		sem:       make(chan struct{}, 1),
+		abandoned: make(chan struct{}),
+		leak:      leaks.track("VM"),
+	}
+	vm.self = weak.Make(vm)
+	vm.SetUserData(config.userData)
+	vm.memory = &memoryTracker{backend: lib.backend, limit: int64(config.memoryLimit)}
+	if config.writer != nil {
+		vm.output = newScriptOutput(config.writer)
+	}
+	vm.handle = lib.backend.NewVM(config.backendConfig(vm))
+	vm.cleanup = runtime.AddCleanup(vm, cleanUpVM, vm.resources())
+	return vm, nil
+}
+
+// Close closes the library. If any VMs created from it are still alive, the library is unloaded once the last
+// of them is freed; no new VMs can be created from it either way. Close returns ErrLibraryClosed if the library
+// was already closed.
+func (lib *Library) Close() error {
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	if lib.closing {
+		return ErrLibraryClosed
+	}
+
+	lib.closing = true
+
+	if lib.vmCount == 0 {
+		return lib.unload()
+	}
+
+	return nil
+
+}
+
+// vmFreed is called when a VM created from the library is freed, unloading the library if it was
+// closed while the VM was alive.
+func (lib *Library) vmFreed() {
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	lib.vmCount--
+
+	if lib.closing && lib.vmCount == 0 {
+		lib.unload()
+	}
+
+}
+
+func (lib *Library) unload() error {
+	if lib.closed {
+		return nil
+	}
+	lib.closed = true
+	defaultLibrary.CompareAndSwap(lib, nil)
+	return lib.backend.Close()
+}
+
+// Capabilities returns a report of the version and optional functions supported by the library loaded
+// by Init().
+func Capabilities() LibraryCapabilities {
+	lib := defaultLibrary.Load()
+	if lib == nil {
+		return LibraryCapabilities{}
+	}
+	return lib.capabilities
+}
+
+// VersionNumber returns the version number of the scripting engine loaded by Init(), as major, minor,
+// and patch numbers, or zeroes if the bindings haven't been initialized.
+func VersionNumber() (int, int, int) {
+	lib := defaultLibrary.Load()
+	if lib == nil {
+		return 0, 0, 0
+	}
+	return lib.VersionNumber()
+}
+
+// NewConfig creates a new configuration for creating a VM from the library loaded by Init(). It can be called
+// before Init(), as configurations don't depend on the library.
+func NewConfig() Config {
+	return Config{}.withDefaultCallbacks()
+}
+
+// NewVM creates a new VM from the library loaded by Init(), using the provided configuration.
+// NewVM panics with ErrNotInitialized if the bindings haven't been initialized; CreateVM() returns it instead.
+func NewVM(config Config) *VM {
+	vm, err := CreateVM(config)
+	if err != nil {
+		panic(err)
+	}
+	return vm
+}
+
+// CreateVM is like NewVM(), but returns ErrNotInitialized if the bindings haven't been initialized (or
+// ErrLibraryClosed if the library has been closed), rather than panicking.
+func CreateVM(config Config) (*VM, error) {
+	lib := defaultLibrary.Load()
+	if lib == nil {
+		return nil, ErrNotInitialized
+	}
+	return lib.CreateVM(config)
+}
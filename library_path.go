@@ -0,0 +1,212 @@
+package wrengo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// LibraryPathEnv is the environment variable that can be set to a Wren library file, or to a directory (or a list
+// of directories, separated by the OS's path list separator) containing one. It's searched after the directory
+// explicitly passed to InitFromDirectory.
+const LibraryPathEnv = "WRENGO_LIB_PATH"
+
+// LibraryCandidate is a path that was tried when looking for the Wren library, along with the reason it couldn't
+// be loaded.
+type LibraryCandidate struct {
+	Path string
+	Err  error
+}
+
+// LibraryNotFoundError is returned when no Wren library could be loaded from any of the searched locations.
+// Candidates lists every path that was tried, in order.
+type LibraryNotFoundError struct {
+	Candidates []LibraryCandidate
+}
+
+func (e *LibraryNotFoundError) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString("error: couldn't load a Wren library for ")
+	sb.WriteString(runtime.GOOS + "/" + runtime.GOARCH)
+	sb.WriteString("; tried:")
+	for _, c := range e.Candidates {
+		sb.WriteString("\n\t")
+		sb.WriteString(c.String())
+	}
+	return sb.String()
+}
+
+// LibraryFileNames returns the file names the Wren library may have for the current platform, in the order
+// they're tried. The first one matches the naming used by the libraries shipped in the lib directory; the others
+// are common aliases for the same OS and architecture.
+func LibraryFileNames() []string {
+
+	osNames := []string{}
+	ext := ""
+
+	switch runtime.GOOS {
+	case "darwin":
+		osNames = []string{"wren_macos", "wren_darwin"}
+		ext = ".dylib"
+	case "linux":
+		osNames = []string{"wren_linux"}
+		ext = ".so"
+	case "windows":
+		osNames = []string{"wren_win", "wren_windows"}
+		ext = ".dll"
+	default:
+		osNames = []string{"wren_" + runtime.GOOS}
+		ext = ".so"
+	}
+
+	archNames := []string{}
+
+	switch runtime.GOARCH {
+	case "386":
+		archNames = []string{"_x86", "_386", "_i386"}
+	case "amd64":
+		archNames = []string{"_x86_64", "_amd64", "_x64"}
+	case "arm":
+		archNames = []string{"_arm"}
+	case "arm64":
+		archNames = []string{"_arm_64", "_arm64", "_aarch64"}
+	default:
+		archNames = []string{"_" + runtime.GOARCH}
+	}
+
+	names := []string{}
+	for _, a := range archNames {
+		for _, o := range osNames {
+			names = append(names, o+a+ext)
+		}
+	}
+
+	return names
+
+}
+
+// systemLibraryNames returns the names the Wren library commonly has when installed system-wide.
+// These are passed to the OS loader as-is, so they're looked up using the OS's own search rules.
+func systemLibraryNames() []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"libwren.dylib"}
+	case "windows":
+		return []string{"wren.dll", "libwren.dll"}
+	default:
+		return []string{"libwren.so", "libwren.so.0"}
+	}
+}
+
+// librarySearchDirectories returns the directories searched for the Wren library, in order: the explicitly
+// provided directory (if any), the directories from the WRENGO_LIB_PATH environment variable, the executable's
+// directory and the working directory (along with the lib directories under those two).
+func librarySearchDirectories(dir string) []string {
+
+	dirs := []string{}
+
+	if dir != "" {
+		dirs = append(dirs, dir)
+	}
+
+	for _, envDir := range filepath.SplitList(os.Getenv(LibraryPathEnv)) {
+		// Entries pointing straight to a library file are tried separately.
+		if info, err := os.Stat(envDir); envDir != "" && (err != nil || info.IsDir()) {
+			dirs = append(dirs, envDir)
+		}
+	}
+
+	if exe, err := os.Executable(); err == nil {
+		exeDir := filepath.Dir(exe)
+		dirs = append(dirs, exeDir, filepath.Join(exeDir, "lib"))
+	}
+
+	if wd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, wd, filepath.Join(wd, "lib"))
+	}
+
+	return dirs
+
+}
+
+// loadLibraryFromSearchPath tries to load the Wren library from each candidate location in turn, returning the
+// handle and path of the first one that loads. If none do, a *LibraryNotFoundError listing each attempt is returned.
+func loadLibraryFromSearchPath(dir string) (uintptr, string, error) {
+
+	notFound := &LibraryNotFoundError{}
+	tried := map[string]bool{}
+
+	try := func(libPath string, checkExists bool) (uintptr, bool) {
+
+		if tried[libPath] {
+			return 0, false
+		}
+		tried[libPath] = true
+
+		if checkExists {
+			info, err := os.Stat(libPath)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					err = fs.ErrNotExist
+				}
+				notFound.Candidates = append(notFound.Candidates, LibraryCandidate{Path: libPath, Err: err})
+				return 0, false
+			}
+			if info.IsDir() {
+				notFound.Candidates = append(notFound.Candidates, LibraryCandidate{Path: libPath, Err: errors.New("is a directory")})
+				return 0, false
+			}
+		}
+
+		lib, err := loadLibrary(libPath)
+		if err != nil {
+			notFound.Candidates = append(notFound.Candidates, LibraryCandidate{Path: libPath, Err: err})
+			return 0, false
+		}
+
+		return lib, true
+
+	}
+
+	// WRENGO_LIB_PATH can also point straight to the library file.
+	if envPath := os.Getenv(LibraryPathEnv); envPath != "" {
+		if info, err := os.Stat(envPath); err == nil && !info.IsDir() {
+			if lib, ok := try(filepath.Clean(envPath), true); ok {
+				return lib, envPath, nil
+			}
+		}
+	}
+
+	for _, d := range librarySearchDirectories(dir) {
+
+		if abs, err := filepath.Abs(d); err == nil {
+			d = abs
+		}
+
+		for _, name := range LibraryFileNames() {
+			libPath := filepath.Join(d, name)
+			if lib, ok := try(libPath, true); ok {
+				return lib, libPath, nil
+			}
+		}
+
+	}
+
+	for _, name := range systemLibraryNames() {
+		if lib, ok := try(name, false); ok {
+			return lib, name, nil
+		}
+	}
+
+	return 0, "", notFound
+
+}
+
+// String returns a human-readable version of the candidate, suitable for logging.
+func (c LibraryCandidate) String() string {
+	return fmt.Sprintf("%s: %v", c.Path, c.Err)
+}
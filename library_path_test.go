@@ -0,0 +1,83 @@
+package wrengo
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLibraryFileNames(t *testing.T) {
+
+	names := LibraryFileNames()
+	if len(names) == 0 {
+		t.Fatal("LibraryFileNames() returned no names")
+	}
+
+	ext := map[string]string{"darwin": ".dylib", "windows": ".dll"}[runtime.GOOS]
+	if ext == "" {
+		ext = ".so"
+	}
+
+	for i, name := range names {
+		if filepath.Ext(name) != ext {
+			t.Errorf("%q doesn't have the %s extension", name, ext)
+		}
+		if slices.Contains(names[:i], name) {
+			t.Errorf("%q is listed twice", name)
+		}
+	}
+
+	// The first name is the one the library shipped in the lib directory has, if there's one for the platform
+	shipped, err := filepath.Glob(filepath.Join("lib", "*"+ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range shipped {
+		if slices.Contains(names, filepath.Base(path)) {
+			if _, err := os.Stat(filepath.Join("lib", names[0])); err != nil {
+				t.Errorf("the first name, %q, isn't the one the library in the lib directory has (%s)", names[0], path)
+			}
+		}
+	}
+
+}
+
+func TestLibrarySearchDirectories(t *testing.T) {
+
+	envDir := t.TempDir()
+	envFile := filepath.Join(envDir, "libwren.so")
+	if err := os.WriteFile(envFile, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(LibraryPathEnv, envDir+string(filepath.ListSeparator)+envFile)
+
+	dirs := librarySearchDirectories("explicit")
+
+	if len(dirs) < 2 || dirs[0] != "explicit" || dirs[1] != envDir {
+		t.Errorf("librarySearchDirectories() = %q; want the explicit directory, then %q", dirs, envDir)
+	}
+	// Library files in the environment variable are tried on their own, not searched as directories
+	if slices.Contains(dirs, envFile) {
+		t.Errorf("librarySearchDirectories() = %q; it shouldn't include the file %q", dirs, envFile)
+	}
+
+}
+
+func TestLibraryNotFoundError(t *testing.T) {
+
+	err := &LibraryNotFoundError{Candidates: []LibraryCandidate{
+		{Path: "lib/one.so", Err: os.ErrNotExist},
+		{Path: "lib/two.so", Err: os.ErrPermission},
+	}}
+
+	msg := err.Error()
+	for _, c := range err.Candidates {
+		if !strings.Contains(msg, c.Path) {
+			t.Errorf("Error() = %q; it doesn't list %q", msg, c.Path)
+		}
+	}
+
+}
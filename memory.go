@@ -0,0 +1,149 @@
+package wrengo
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+)
+
+// ErrMemoryLimit is matched (using errors.Is()) by the *RuntimeError returned when a VM goes over the memory limit
+// set with Config.WithSoftMemoryLimit().
+var ErrMemoryLimit = errors.New("error: memory limit exceeded")
+
+// MemStats reports the memory allocated by a VM.
+type MemStats struct {
+	Current     int // Bytes currently allocated, including garbage that hasn't been collected yet
+	Peak        int // The most bytes allocated at once over the VM's lifetime
+	Allocations int // The number of allocations made over the VM's lifetime
+}
+
+// WithMemoryTracking makes VMs keep count of the memory they allocate, as reported by VM.MemStats(). Every
+// allocation Wren makes then goes through Go, which makes allocating noticeably slower, so it's off by default.
+func (cfg Config) WithMemoryTracking() Config {
+	cfg.trackMemory = true
+	return cfg
+}
+
+// WithSoftMemoryLimit sets the most memory, in bytes, that a VM should have allocated; 0 means no limit.
+// WithSoftMemoryLimit panics if the limit is negative.
+//
+// The limit is soft, as Wren can't recover from a failed allocation: it's only checked when the script calls a Go
+// foreign method (and when Run() or CallHandle.Call() returns), and if the VM is still over it after collecting
+// garbage, the fiber is aborted and a *RuntimeError matching ErrMemoryLimit is returned. A script that allocates
+// without calling into Go can go over it (and exhaust the process's memory) before it's stopped, so it doesn't
+// protect against untrusted scripts; run those in a separate process with its own memory limit.
+//
+// Setting a memory limit also turns on memory tracking (see WithMemoryTracking()).
+func (cfg Config) WithSoftMemoryLimit(bytes int) Config {
+	if bytes < 0 {
+		panic(fmt.Errorf("error: invalid memory limit (%d); it can't be negative", bytes))
+	}
+	cfg.memoryLimit = bytes
+	return cfg
+}
+
+// MemStats returns the memory the VM has allocated. Memory is only tracked if the VM was created with
+// WithMemoryTracking() or WithSoftMemoryLimit(); otherwise, MemStats returns zeroes.
+func (vm *VM) MemStats() MemStats {
+	return MemStats{
+		Current:     int(vm.memory.current.Load()),
+		Peak:        int(vm.memory.peak.Load()),
+		Allocations: int(vm.memory.allocations.Load()),
+	}
+}
+
+// allocationHeaderSize is the size of the header that stores the size of each block of memory allocated for Wren;
+// it keeps the memory handed to Wren aligned as malloc() would.
+const allocationHeaderSize = 16
+
+// memoryTracker is a VM's allocator. It wraps the C allocator, keeping count of the memory the VM has allocated.
+type memoryTracker struct {
+	backend     Backend
+	limit       int64
+	current     atomic.Int64
+	peak        atomic.Int64
+	allocations atomic.Int64
+
+	// The Done channel of the context of the running call into the VM, if it can be done, and whether an allocation
+	// has found it closed (see VM.withContext())
+	done        atomic.Pointer[<-chan struct{}]
+	interrupted atomic.Bool
+}
+
+// reallocate is the VM's reallocateFn. Wren doesn't pass the size of the memory being resized or freed, so each
+// block starts with a header holding its size.
+func (t *memoryTracker) reallocate(memory uintptr, newSize uintptr) uintptr {
+
+	var block, oldSize uintptr
+
+	if memory != 0 {
+		block = memory - allocationHeaderSize
+		oldSize = *(*uintptr)(cPointer(block))
+	}
+
+	if newSize == 0 {
+		if block != 0 {
+			t.backend.Reallocate(block, 0)
+			t.current.Add(-int64(oldSize))
+		}
+		return 0
+	}
+
+	if done := t.done.Load(); done != nil {
+		select {
+		case <-*done:
+			t.interrupted.Store(true)
+		default:
+		}
+	}
+
+	newBlock := t.backend.Reallocate(block, newSize+allocationHeaderSize)
+	if newBlock == 0 {
+		return 0
+	}
+
+	*(*uintptr)(cPointer(newBlock)) = newSize
+
+	if memory == 0 {
+		t.allocations.Add(1)
+	}
+
+	current := t.current.Add(int64(newSize) - int64(oldSize))
+	if current > t.peak.Load() {
+		t.peak.Store(current)
+	}
+
+	return newBlock + allocationHeaderSize
+
+}
+
+// cPointer converts an address in memory allocated by C to a pointer.
+func cPointer(address uintptr) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&address))
+}
+
+// memoryLimitExceeded returns true if the VM has gone over its memory limit, collecting garbage first to make sure.
+func (vm *VM) memoryLimitExceeded() bool {
+
+	t := vm.memory
+
+	if t.limit <= 0 || t.current.Load() <= t.limit {
+		return false
+	}
+
+	if vm.lib.capabilities.CollectGarbage {
+		vm.lib.backend.CollectGarbage(vm.handle)
+	}
+
+	return t.current.Load() > t.limit
+
+}
+
+// memoryLimitError returns the error for the VM going over its memory limit.
+func (vm *VM) memoryLimitError() *RuntimeError {
+	return &RuntimeError{
+		Message: fmt.Sprintf("Memory limit of %d bytes exceeded.", vm.memory.limit),
+		err:     ErrMemoryLimit,
+	}
+}
@@ -0,0 +1,108 @@
+package wrengo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// CanonicalModuleName returns the name a module is registered under in a VM. Module names are slash-separated paths,
+// without any ".wren" extension or leading "./" or "/"; for example, "./scripts/player.wren" becomes
+// "scripts/player". Names starting with "./" or "../" are relative to the directory of the importing module (if
+// there is one), while others are relative to the root.
+//
+// Run(), RunFile(), CallHandle(), Variable() and the like all accept module names in any of these forms, and imports
+// are resolved the same way, so "./scripts/player.wren" and "scripts/player" refer to the same module.
+func CanonicalModuleName(importer, name string) string {
+
+	if name == "" {
+		return name
+	}
+
+	name = strings.TrimSuffix(name, ".wren")
+
+	if importer != "" && (strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../")) {
+		name = path.Join(path.Dir(importer), name)
+	}
+
+	return strings.TrimPrefix(path.Clean(name), "/")
+
+}
+
+// ModuleLoader loads the source of the Wren modules a VM imports.
+type ModuleLoader interface {
+	// LoadModule returns the source of the named module. If the loader doesn't have the module, the returned
+	// error should match fs.ErrNotExist (using errors.Is()), so that the next loader can be tried.
+	LoadModule(name string) ([]byte, error)
+}
+
+// ModuleLoaderFunc is a function that's used as a ModuleLoader, for modules whose sources are generated from Go.
+type ModuleLoaderFunc func(name string) ([]byte, error)
+
+func (f ModuleLoaderFunc) LoadModule(name string) ([]byte, error) {
+	return f(name)
+}
+
+// FSLoader loads modules from a file system, as files named after the module, with the ".wren" extension added
+// (so "scripts/player" is loaded from "scripts/player.wren").
+type FSLoader struct {
+	FS fs.FS
+}
+
+func (l FSLoader) LoadModule(name string) ([]byte, error) {
+	if path.Ext(name) != ".wren" {
+		name += ".wren"
+	}
+	return fs.ReadFile(l.FS, name)
+}
+
+// MapLoader loads modules from memory, mapping each module's canonical name (see CanonicalModuleName()) to its
+// source.
+type MapLoader map[string]string
+
+func (l MapLoader) LoadModule(name string) ([]byte, error) {
+	src, ok := l[name]
+	if !ok {
+		return nil, fmt.Errorf("module '%s': %w", name, fs.ErrNotExist)
+	}
+	return []byte(src), nil
+}
+
+// OverlayLoader tries each of its loaders in order, loading a module from the first one that has it. This allows,
+// for example, a folder of mods to override some of a game's base scripts, with the rest still loaded from the
+// base game. Loading stops at the first error that doesn't match fs.ErrNotExist.
+type OverlayLoader []ModuleLoader
+
+func (l OverlayLoader) LoadModule(name string) ([]byte, error) {
+	for _, loader := range l {
+		src, err := loader.LoadModule(name)
+		if err == nil {
+			return src, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("module '%s': %w", name, fs.ErrNotExist)
+}
+
+// WithModuleLoaders adds module loaders to the configuration, to load the modules VMs import. Loaders are tried
+// in the order they're added, so to override modules from one loader with those from another, add the
+// overriding loader first.
+func (cfg Config) WithModuleLoaders(loaders ...ModuleLoader) Config {
+	cfg.moduleLoaders = append(slices.Clip(cfg.moduleLoaders), loaders...)
+	return cfg
+}
+
+// loadModule loads the module's source from the configuration's module loaders, returning nil if it can't be loaded
+// (in which case Wren reports the error).
+func (cfg Config) loadModule(name string) []byte {
+	src, err := OverlayLoader(cfg.moduleLoaders).LoadModule(name)
+	if err != nil {
+		return nil
+	}
+	return src
+}
@@ -0,0 +1,128 @@
+package wrengo
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOverlayLoader(t *testing.T) {
+
+	base := FSLoader{FS: fstest.MapFS{
+		"main.wren":           {Data: []byte("base main")},
+		"scripts/player.wren": {Data: []byte("base player")},
+	}}
+	mods := MapLoader{"scripts/player": "modded player"}
+	broken := errors.New("broken")
+
+	loader := OverlayLoader{mods, base}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"main", "base main"},
+		{"main.wren", "base main"},
+		{"scripts/player", "modded player"}, // The first loader that has the module wins
+	}
+
+	for _, test := range tests {
+		src, err := loader.LoadModule(test.name)
+		if err != nil || string(src) != test.want {
+			t.Errorf("LoadModule(%q) = %q, %v; want %q", test.name, src, err, test.want)
+		}
+	}
+
+	if _, err := loader.LoadModule("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("LoadModule() of a missing module returned %v; want an error matching fs.ErrNotExist", err)
+	}
+
+	// Errors other than missing modules stop the search
+	loader = OverlayLoader{
+		ModuleLoaderFunc(func(name string) ([]byte, error) { return nil, broken }),
+		base,
+	}
+	if _, err := loader.LoadModule("main"); !errors.Is(err, broken) {
+		t.Errorf("LoadModule() returned %v; want the first loader's error", err)
+	}
+
+}
+
+func TestWithModuleLoaders(t *testing.T) {
+
+	base := NewConfig().WithModuleLoaders(MapLoader{"main": "base"})
+
+	// Configs derived from the same one don't share their loaders
+	modded := base.WithModuleLoaders(MapLoader{"main": "modded", "mod": "mod"})
+	other := base.WithModuleLoaders(MapLoader{"other": "other"})
+
+	tests := []struct {
+		cfg  Config
+		name string
+		want string
+	}{
+		{base, "main", "base"},
+		{modded, "main", "base"}, // Loaders added earlier are tried first
+		{modded, "mod", "mod"},
+		{modded, "other", ""},
+		{other, "other", "other"},
+		{other, "mod", ""},
+	}
+
+	for _, test := range tests {
+		if got := string(test.cfg.loadModule(test.name)); got != test.want {
+			t.Errorf("loadModule(%q) = %q; want %q", test.name, got, test.want)
+		}
+	}
+
+}
+
+func TestCanonicalModuleName(t *testing.T) {
+
+	tests := []struct {
+		importer, name, want string
+	}{
+		{"", "", ""},
+		{"", "main", "main"},
+		{"", "main.wren", "main"},
+		{"", "./scripts/player.wren", "scripts/player"},
+		{"", "/scripts/player", "scripts/player"},
+		{"", "scripts//player", "scripts/player"},
+		{"", "scripts/../main", "main"},
+		{"scripts/player", "./weapon", "scripts/weapon"},
+		{"scripts/player", "../engine/input.wren", "engine/input"},
+		{"scripts/player", "engine/input", "engine/input"}, // Not relative to the importer
+		{"main", "./util", "util"},
+	}
+
+	for _, test := range tests {
+		if got := CanonicalModuleName(test.importer, test.name); got != test.want {
+			t.Errorf("CanonicalModuleName(%q, %q) = %q; want %q", test.importer, test.name, got, test.want)
+		}
+	}
+
+}
+
+func TestModuleNamesAreCanonical(t *testing.T) {
+
+	fake, vm := newFakeVM(t, nil)
+
+	var ran []string
+	fake.OnInterpret = func(vm *VM, module, source string) error {
+		ran = append(ran, module)
+		return nil
+	}
+
+	if err := vm.Run("./scripts/player.wren", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ran) != 1 || ran[0] != "scripts/player" {
+		t.Errorf("ran %q; want the module run as \"scripts/player\"", ran)
+	}
+	if !vm.HasModule("scripts/player.wren") {
+		t.Error("HasModule() doesn't find the module under another form of its name")
+	}
+
+}
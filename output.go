@@ -0,0 +1,119 @@
+package wrengo
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// WithWriter sets the Writer that a VM's script output (from System.print() and friends) is written to. NewConfig()
+// writes to os.Stdout by default; passing nil discards the output instead.
+//
+// Output is written a line at a time, so lines from several VMs sharing a Writer don't get mixed up, even when the
+// VMs run concurrently; VMs writing to the same Writer also never call Write() at the same time, so a plain
+// bytes.Buffer or file can be shared safely. Text without a trailing newline is written when the Run() or Call()
+// that printed it returns.
+func (cfg Config) WithWriter(w io.Writer) Config {
+	if w == nil {
+		w = io.Discard
+	}
+	cfg.writer = w
+	return cfg
+}
+
+// scriptOutput buffers a VM's script output, writing it to the VM's Writer a line at a time.
+type scriptOutput struct {
+	w      io.Writer
+	lock   *writerLock
+	mu     sync.Mutex
+	buffer []byte
+}
+
+// writerLock serializes writes to a Writer shared between VMs.
+type writerLock struct {
+	sync.Mutex
+	refs int
+}
+
+var writerLocks = map[any]*writerLock{}
+var writerLocksLock sync.Mutex
+
+func newScriptOutput(w io.Writer) *scriptOutput {
+
+	out := &scriptOutput{w: w}
+
+	// Writers that can't be used as map keys can't be shared between VMs, unless they're wrapped in one that can
+	if !reflect.TypeOf(w).Comparable() {
+		out.lock = &writerLock{}
+		return out
+	}
+
+	writerLocksLock.Lock()
+	defer writerLocksLock.Unlock()
+
+	lock, ok := writerLocks[w]
+	if !ok {
+		lock = &writerLock{}
+		writerLocks[w] = lock
+	}
+	lock.refs++
+	out.lock = lock
+
+	return out
+
+}
+
+func (out *scriptOutput) write(text string) {
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	out.buffer = append(out.buffer, text...)
+
+	if i := bytes.LastIndexByte(out.buffer, '\n'); i >= 0 {
+		out.writeBuffered(i + 1)
+	}
+
+}
+
+// flush writes any output left over from a line that wasn't finished.
+func (out *scriptOutput) flush() {
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	if len(out.buffer) > 0 {
+		out.writeBuffered(len(out.buffer))
+	}
+
+}
+
+func (out *scriptOutput) writeBuffered(n int) {
+
+	out.lock.Lock()
+	out.w.Write(out.buffer[:n])
+	out.lock.Unlock()
+
+	out.buffer = append(out.buffer[:0], out.buffer[n:]...)
+
+}
+
+// close flushes the output and releases the Writer's lock, once the VM is freed.
+func (out *scriptOutput) close() {
+
+	out.flush()
+
+	if !reflect.TypeOf(out.w).Comparable() {
+		return
+	}
+
+	writerLocksLock.Lock()
+	defer writerLocksLock.Unlock()
+
+	out.lock.refs--
+	if out.lock.refs == 0 {
+		delete(writerLocks, out.w)
+	}
+
+}
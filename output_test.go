@@ -0,0 +1,95 @@
+package wrengo
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakePrint prints the text from the VM's script, as System.write() would.
+func fakePrint(fake *FakeBackend, vm *VM, text string) {
+	fake.vm(vm.handle).config.Write(vm.handle, text)
+}
+
+func TestWriterBuffersLines(t *testing.T) {
+
+	out := &bytes.Buffer{}
+	fake, vm := newFakeVM(t, func(cfg Config) Config { return cfg.WithWriter(out) })
+
+	fake.OnInterpret = func(vm *VM, module, source string) error {
+		fakePrint(fake, vm, "Hello, ")
+		fakePrint(fake, vm, "world!\nUnfinished")
+		if got := out.String(); got != "Hello, world!\n" {
+			t.Errorf("the output while running is %q; want only the finished line", got)
+		}
+		return nil
+	}
+
+	if err := vm.Run("main", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := out.String(); got != "Hello, world!\nUnfinished" {
+		t.Errorf("the output is %q; want the unfinished line written once Run() returns", got)
+	}
+
+}
+
+func TestWriterNilDiscards(t *testing.T) {
+
+	fake, vm := newFakeVM(t, func(cfg Config) Config { return cfg.WithWriter(nil) })
+
+	fake.OnInterpret = func(vm *VM, module, source string) error {
+		fakePrint(fake, vm, "discarded\n")
+		return nil
+	}
+
+	if err := vm.Run("main", ""); err != nil {
+		t.Fatal(err)
+	}
+
+}
+
+func TestWriterSharedBetweenVMs(t *testing.T) {
+
+	// A plain bytes.Buffer can be shared, and lines from several VMs don't get mixed up
+	out := &bytes.Buffer{}
+
+	wg := sync.WaitGroup{}
+	for i := range 4 {
+
+		output := newScriptOutput(out)
+		line := fmt.Sprintf("line from VM %d", i)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer output.close()
+			for range 100 {
+				for _, word := range strings.SplitAfter(line, " ") {
+					output.write(word)
+				}
+				output.write("\n")
+			}
+		}()
+
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 400 {
+		t.Fatalf("got %d lines; want 400", len(lines))
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "line from VM ") || len(line) != len("line from VM 0") {
+			t.Fatalf("got the mixed up line %q", line)
+		}
+	}
+
+	if len(writerLocks) != 0 {
+		t.Errorf("%d Writer locks are left once every VM is done with them", len(writerLocks))
+	}
+
+}
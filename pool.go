@@ -0,0 +1,221 @@
+package wrengo
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrPoolClosed is returned by Pool.Acquire() once the Pool has been closed.
+var ErrPoolClosed = errors.New("error: pool already closed")
+
+// PoolModule is a module each of a Pool's VMs runs before it's first acquired.
+type PoolModule struct {
+	Name   string
+	Source string
+}
+
+// Pool keeps VMs that have already run a set of modules ready for use, so that running a short script doesn't
+// have to wait for a VM to be created and those modules to be compiled first:
+//
+//	pool, err := wrengo.NewPool(config, 8, wrengo.PoolModule{Name: "prelude", Source: prelude})
+//	...
+//	vm, err := pool.Acquire()
+//	if err != nil {
+//		return err
+//	}
+//	defer pool.Release(vm)
+//
+// VMs are reused as they are, so anything a script leaves in a VM is still there the next time the VM is acquired.
+// That includes the modules it ran: Wren can't unload a module, or run one again under the same name, so each
+// script has to be run under a module name of its own (say, "request-1234"), and the VMs grow with every one. Use
+// SetMaxUses() to have the Pool replace VMs after a while; better yet, run the scripts known ahead of time as the
+// Pool's modules, and call into them with CallHandles or Eval(), which don't add modules.
+//
+// A Pool is safe to use from several goroutines.
+type Pool struct {
+	lib     *Library
+	config  Config
+	size    int
+	modules []PoolModule
+
+	mu       sync.Mutex
+	idle     []*VM
+	acquired map[*VM]struct{} // The VMs acquired and not released yet
+	closed   bool
+	maxUses  int
+}
+
+// NewPool creates a Pool of VMs from this library, using the provided configuration. The Pool starts out with size
+// idle VMs, each of which has run the modules, in order; if any of them fails to, NewPool returns its error.
+// NewPool panics if size is less than 1.
+func (lib *Library) NewPool(config Config, size int, modules ...PoolModule) (*Pool, error) {
+
+	if size < 1 {
+		panic(fmt.Errorf("error: invalid pool size (%d); it must be at least 1", size))
+	}
+
+	p := &Pool{
+		lib:      lib,
+		config:   config,
+		size:     size,
+		modules:  modules,
+		acquired: map[*VM]struct{}{},
+	}
+
+	for i := 0; i < size; i++ {
+		vm, err := p.newVM()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.idle = append(p.idle, vm)
+	}
+
+	return p, nil
+
+}
+
+// NewPool creates a Pool of VMs from the library loaded by Init(); see Library.NewPool(). It returns
+// ErrNotInitialized if the bindings haven't been initialized.
+func NewPool(config Config, size int, modules ...PoolModule) (*Pool, error) {
+	lib := defaultLibrary.Load()
+	if lib == nil {
+		return nil, ErrNotInitialized
+	}
+	return lib.NewPool(config, size, modules...)
+}
+
+// newVM creates a VM that has run the Pool's modules.
+func (p *Pool) newVM() (*VM, error) {
+
+	vm, err := p.lib.CreateVM(p.config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, module := range p.modules {
+		if err := vm.Run(module.Name, module.Source); err != nil {
+			vm.Free()
+			return nil, err
+		}
+	}
+
+	return vm, nil
+
+}
+
+// Acquire returns one of the Pool's idle VMs, or, if none are idle, a new VM that has run the Pool's modules.
+// Once done with the VM, pass it to Release(). Acquire returns ErrPoolClosed if the Pool has been closed.
+func (p *Pool) Acquire() (*VM, error) {
+
+	p.mu.Lock()
+
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+
+	if n := len(p.idle); n > 0 {
+		vm := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.acquired[vm] = struct{}{}
+		p.mu.Unlock()
+		vm.poolUses++
+		return vm, nil
+	}
+
+	p.mu.Unlock()
+
+	vm, err := p.newVM()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.acquired[vm] = struct{}{}
+	p.mu.Unlock()
+	vm.poolUses++
+	return vm, nil
+
+}
+
+// Release returns a VM acquired from the Pool, so it can be acquired again. The VM is freed instead if a call
+// into it has failed with a runtime error (including going over its memory limit), as that could have left it in
+// any state, if it's been acquired as many times as SetMaxUses() allows, or if the Pool already has as many idle
+// VMs as it started with, or has been closed. A VM that's kept has its user data set back to the configuration's
+// (see VM.SetUserData()).
+//
+// Release panics if the VM wasn't acquired from the Pool, or has already been released, as the Pool would otherwise
+// hand out the same VM twice, or free a VM it doesn't own.
+func (p *Pool) Release(vm *VM) {
+
+	p.mu.Lock()
+	_, ok := p.acquired[vm]
+	delete(p.acquired, vm)
+	p.mu.Unlock()
+
+	if !ok {
+		panic(fmt.Errorf("error: releasing a VM that wasn't acquired from the pool, or was already released"))
+	}
+
+	unlock, err := vm.lock()
+	if err != nil {
+		// A VM still running a call that was given up on is freed once the call returns (see VM.RunContext())
+		vm.Free()
+		return
+	}
+	reusable := !vm.freed && !vm.failed
+	vm.SetUserData(vm.config.userData)
+	unlock()
+
+	if reusable {
+		p.mu.Lock()
+		worn := p.maxUses > 0 && vm.poolUses >= p.maxUses
+		if !p.closed && !worn && len(p.idle) < p.size {
+			p.idle = append(p.idle, vm)
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+	}
+
+	vm.Free()
+
+}
+
+// SetMaxUses sets how many times each VM can be acquired before it's freed on release, rather than kept, so that
+// the modules the scripts run in it don't pile up forever; a new VM takes its place the next time one's needed.
+// 0, the default, means VMs are kept for as long as they're reusable. SetMaxUses panics if uses is negative.
+func (p *Pool) SetMaxUses(uses int) {
+	if uses < 0 {
+		panic(fmt.Errorf("error: invalid maximum number of uses (%d); it can't be negative", uses))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxUses = uses
+}
+
+// Close frees the Pool's idle VMs; the VMs acquired from it are freed as they're released. Close returns
+// ErrPoolClosed if the Pool was already closed.
+func (p *Pool) Close() error {
+
+	p.mu.Lock()
+
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+
+	p.mu.Unlock()
+
+	for _, vm := range idle {
+		vm.Free()
+	}
+
+	return nil
+
+}
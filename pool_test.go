@@ -0,0 +1,212 @@
+package wrengo
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// newFakePool creates a Pool of VMs from a FakeBackend, each of which has run a "prelude" module; it's closed when
+// the test ends.
+func newFakePool(t *testing.T, size int) (*FakeBackend, *Pool) {
+
+	t.Helper()
+
+	fake, lib := newFakeLibrary(t)
+
+	pool, err := lib.NewPool(lib.NewConfig().WithErrorHandler(nil), size, PoolModule{Name: "prelude", Source: "class Prelude {}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+
+	return fake, pool
+
+}
+
+func TestPoolReusesVMs(t *testing.T) {
+
+	fake, pool := newFakePool(t, 2)
+
+	a, err := pool.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := pool.Acquire()
+	c, _ := pool.Acquire() // Past the Pool's size, a new VM is created
+
+	for _, vm := range []*VM{a, b, c} {
+		if !vm.HasModule("prelude") {
+			t.Error("an acquired VM hasn't run the Pool's modules")
+		}
+	}
+	if a == b || b == c || a == c {
+		t.Fatal("Acquire() handed out the same VM twice")
+	}
+
+	pool.Release(a)
+	pool.Release(b)
+	pool.Release(c) // The Pool already has as many idle VMs as it started with
+
+	if !c.freed {
+		t.Error("the VM released past the Pool's size wasn't freed")
+	}
+
+	reused := []*VM{}
+	for range 2 {
+		vm, _ := pool.Acquire()
+		reused = append(reused, vm)
+	}
+	if !slices.Contains(reused, a) || !slices.Contains(reused, b) {
+		t.Error("Acquire() didn't reuse the idle VMs")
+	}
+
+	// A VM that failed at runtime is freed rather than kept
+	vm := reused[0]
+	fake.OnInterpret = func(vm *VM, module, source string) error { return errors.New("aborted") }
+	if err := vm.Run("script", ""); err == nil {
+		t.Fatal("Run() didn't fail")
+	}
+	pool.Release(vm)
+	if !vm.freed {
+		t.Error("a VM that failed at runtime wasn't freed on release")
+	}
+
+}
+
+func TestPoolModuleFails(t *testing.T) {
+
+	fake, lib := newFakeLibrary(t)
+
+	fake.OnInterpret = func(vm *VM, module, source string) error { return errors.New("aborted") }
+
+	if _, err := lib.NewPool(lib.NewConfig().WithErrorHandler(nil), 2, PoolModule{Name: "prelude"}); err == nil {
+		t.Error("NewPool() didn't fail, though its module did")
+	}
+
+}
+
+func TestPoolClose(t *testing.T) {
+
+	_, pool := newFakePool(t, 1)
+
+	idle, _ := pool.Acquire()
+	pool.Release(idle)
+	acquired, _ := pool.Acquire()
+
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Close(); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("closing the Pool again returned %v; want ErrPoolClosed", err)
+	}
+	if _, err := pool.Acquire(); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Acquire() from a closed Pool returned %v; want ErrPoolClosed", err)
+	}
+
+	// VMs acquired before the Pool was closed are freed once they're released
+	pool.Release(acquired)
+	if !acquired.freed {
+		t.Error("a VM released to a closed Pool wasn't freed")
+	}
+
+}
+
+func TestPoolSize(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("NewPool() with a size of 0 didn't panic")
+		}
+	}()
+	_, lib := newFakeLibrary(t)
+	lib.NewPool(lib.NewConfig(), 0)
+}
+
+func TestPoolResetsUserData(t *testing.T) {
+
+	_, lib := newFakeLibrary(t)
+
+	pool, err := lib.NewPool(lib.NewConfig().WithUserData("config"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	vm, _ := pool.Acquire()
+	vm.SetUserData("request")
+	pool.Release(vm)
+
+	vm, _ = pool.Acquire()
+	if got := vm.UserData(); got != "config" {
+		t.Errorf("UserData() of a reused VM = %v; want the configuration's", got)
+	}
+	pool.Release(vm)
+
+}
+
+func TestPoolMaxUses(t *testing.T) {
+
+	_, pool := newFakePool(t, 1)
+	pool.SetMaxUses(2)
+
+	first, _ := pool.Acquire()
+	pool.Release(first)
+	vm, _ := pool.Acquire()
+	if vm != first {
+		t.Fatal("the VM wasn't reused before reaching its maximum number of uses")
+	}
+	pool.Release(vm)
+
+	if !first.freed {
+		t.Error("the VM wasn't freed once it reached its maximum number of uses")
+	}
+	if vm, _ := pool.Acquire(); vm == first {
+		t.Error("the worn VM was acquired again")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("SetMaxUses() with a negative number didn't panic")
+		}
+	}()
+	pool.SetMaxUses(-1)
+
+}
+
+func TestPoolReleasesOnlyAcquiredVMs(t *testing.T) {
+
+	_, pool := newFakePool(t, 1)
+	_, other := newFakePool(t, 1)
+
+	panics := func(name string, release func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s didn't panic", name)
+			}
+		}()
+		release()
+	}
+
+	vm, _ := pool.Acquire()
+	pool.Release(vm)
+	panics("releasing a VM twice", func() { pool.Release(vm) })
+
+	// The VM released twice is still only handed out once
+	a, _ := pool.Acquire()
+	b, _ := pool.Acquire()
+	if a == b {
+		t.Error("the VM released twice was acquired twice")
+	}
+
+	fromOther, _ := other.Acquire()
+	panics("releasing a VM from another Pool", func() { pool.Release(fromOther) })
+	if fromOther.freed {
+		t.Error("the Pool freed a VM from another Pool")
+	}
+	other.Release(fromOther)
+
+	pool.Release(a)
+	pool.Release(b)
+
+}
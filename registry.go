@@ -0,0 +1,208 @@
+package wrengo
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrForeignMethodConflict is matched (using errors.Is()) by the error returned when a foreign method is registered
+// in a Registry that already has a function for it.
+var ErrForeignMethodConflict = errors.New("error: foreign method already registered")
+
+// ForeignMethodKey identifies a foreign method: the module (by its canonical name; see CanonicalModuleName()) and
+// class it's declared in, its signature (e.g. "move(_,_)"), and whether it's static.
+type ForeignMethodKey struct {
+	Module    string
+	Class     string
+	Signature string
+	IsStatic  bool
+}
+
+func (k ForeignMethodKey) String() string {
+	if k.IsStatic {
+		return fmt.Sprintf("%s: static %s.%s", k.Module, k.Class, k.Signature)
+	}
+	return fmt.Sprintf("%s: %s.%s", k.Module, k.Class, k.Signature)
+}
+
+// ForeignMethodResolver returns the Go function for a foreign method, or nil if it doesn't have one.
+type ForeignMethodResolver func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction
+
+// Registry maps foreign methods to the Go functions that implement them, so that several packages can each
+// contribute their own bindings to a VM, rather than sharing a single resolver:
+//
+//	registry := wrengo.NewRegistry()
+//	audio.RegisterBindings(registry)
+//	physics.RegisterBindings(registry)
+//	vm := wrengo.NewVM(wrengo.NewConfig().WithRegistry(registry))
+//
+// A foreign method is resolved from the functions registered for it first, then from the wildcard resolvers (in
+// the order they were added), and then from the fallback resolvers (in the same order). A Registry is safe to use
+// from several goroutines, and can be shared by any number of Configs.
+type Registry struct {
+	mu        sync.RWMutex
+	methods   map[ForeignMethodKey]GoForeignFunction
+	wildcards []wildcardResolver
+	fallbacks []ForeignMethodResolver
+}
+
+// wildcardResolver is a resolver for the foreign methods of the classes matching a pair of patterns.
+type wildcardResolver struct {
+	module   string
+	class    string
+	resolver ForeignMethodResolver
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		methods: map[ForeignMethodKey]GoForeignFunction{},
+	}
+}
+
+// Register registers the Go function for the foreign method. It returns an error matching ErrForeignMethodConflict
+// if the Registry already has a function for the method.
+func (r *Registry) Register(module, className, signature string, isStatic bool, fn GoForeignFunction) error {
+
+	key := ForeignMethodKey{
+		Module:    CanonicalModuleName("", module),
+		Class:     className,
+		Signature: strings.ReplaceAll(signature, " ", ""),
+		IsStatic:  isStatic,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.methods[key]; exists {
+		return fmt.Errorf("%w: %s", ErrForeignMethodConflict, key)
+	}
+
+	r.methods[key] = fn
+	return nil
+
+}
+
+// Include registers every foreign method registered in other, along with its wildcard and fallback resolvers
+// (after the Registry's own). If any of other's methods are already registered, nothing is included, and an error
+// matching ErrForeignMethodConflict is returned.
+func (r *Registry) Include(other *Registry) error {
+
+	if other == r {
+		return nil
+	}
+
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key := range other.methods {
+		if _, exists := r.methods[key]; exists {
+			return fmt.Errorf("%w: %s", ErrForeignMethodConflict, key)
+		}
+	}
+
+	for key, fn := range other.methods {
+		r.methods[key] = fn
+	}
+
+	r.wildcards = append(r.wildcards, other.wildcards...)
+	r.fallbacks = append(r.fallbacks, other.fallbacks...)
+
+	return nil
+
+}
+
+// AddWildcard adds a resolver for the foreign methods of every class matching the patterns, which use the syntax
+// of path.Match() (so "*" matches any class, and "engine/*" any module in the engine directory). It panics if
+// either pattern is malformed.
+func (r *Registry) AddWildcard(modulePattern, classPattern string, resolver ForeignMethodResolver) {
+
+	for _, pattern := range []string{modulePattern, classPattern} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(fmt.Errorf("error: invalid pattern '%s': %w", pattern, err))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.wildcards = append(r.wildcards, wildcardResolver{module: modulePattern, class: classPattern, resolver: resolver})
+
+}
+
+// AddFallback adds a resolver for the foreign methods nothing else in the Registry resolves.
+func (r *Registry) AddFallback(resolver ForeignMethodResolver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallbacks = append(r.fallbacks, resolver)
+}
+
+// Methods returns the keys of every foreign method registered with Register(), sorted by module, class, and
+// signature. Methods resolved through wildcard and fallback resolvers aren't known until they're resolved, so
+// they're not included.
+func (r *Registry) Methods() []ForeignMethodKey {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]ForeignMethodKey, 0, len(r.methods))
+	for key := range r.methods {
+		keys = append(keys, key)
+	}
+
+	slices.SortFunc(keys, func(a, b ForeignMethodKey) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	return keys
+
+}
+
+// Resolve returns the Go function for the foreign method, or nil if the Registry doesn't have one.
+func (r *Registry) Resolve(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction {
+
+	r.mu.RLock()
+	fn := r.methods[ForeignMethodKey{Module: module, Class: className, Signature: signature, IsStatic: isStatic}]
+	wildcards := r.wildcards
+	fallbacks := r.fallbacks
+	r.mu.RUnlock()
+
+	if fn != nil {
+		return fn
+	}
+
+	// The resolvers are called without holding the lock, so they can use the Registry themselves
+	for _, w := range wildcards {
+		moduleMatch, _ := path.Match(w.module, module)
+		classMatch, _ := path.Match(w.class, className)
+		if moduleMatch && classMatch {
+			if fn := w.resolver(vm, module, className, signature, isStatic); fn != nil {
+				return fn
+			}
+		}
+	}
+
+	for _, resolver := range fallbacks {
+		if fn := resolver(vm, module, className, signature, isStatic); fn != nil {
+			return fn
+		}
+	}
+
+	return nil
+
+}
+
+// WithRegistry sets the Registry the VM's foreign methods are resolved from. Methods defined with VM.DefineModule()
+// take precedence over it, while a resolver set with WithForeignMethodResolver() is only used for the methods the
+// Registry doesn't resolve.
+func (cfg Config) WithRegistry(registry *Registry) Config {
+	cfg.registry = registry
+	return cfg
+}
@@ -0,0 +1,159 @@
+package wrengo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// returning returns a GoForeignFunction that returns the value, to tell the functions a Registry resolves apart.
+func returning(value any) GoForeignFunction {
+	return func(vm *VM, args []any) any { return value }
+}
+
+// resolved calls the function the Registry resolves for the method, returning nil if it doesn't resolve one.
+func resolved(r *Registry, module, className, signature string, isStatic bool) any {
+	fn := r.Resolve(nil, module, className, signature, isStatic)
+	if fn == nil {
+		return nil
+	}
+	return fn(nil, nil)
+}
+
+func TestRegistryConflict(t *testing.T) {
+
+	r := NewRegistry()
+
+	if err := r.Register("./engine.wren", "Input", "pressed( _ )", true, returning(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same method, however its module and signature are written
+	if err := r.Register("engine", "Input", "pressed(_)", true, returning(2)); !errors.Is(err, ErrForeignMethodConflict) {
+		t.Errorf("Register() of the same method returned %v; want ErrForeignMethodConflict", err)
+	}
+
+	// The instance method of the same name is another method
+	if err := r.Register("engine", "Input", "pressed(_)", false, returning(3)); err != nil {
+		t.Errorf("Register() of the instance method returned %v", err)
+	}
+
+	if got := resolved(r, "engine", "Input", "pressed(_)", true); got != 1 {
+		t.Errorf("Resolve() = %v; want the first function registered", got)
+	}
+
+	other := NewRegistry()
+	other.Register("audio", "Sound", "play()", false, returning(4))
+	other.Register("engine", "Input", "pressed(_)", true, returning(5))
+
+	if err := r.Include(other); !errors.Is(err, ErrForeignMethodConflict) {
+		t.Errorf("Include() of a conflicting Registry returned %v; want ErrForeignMethodConflict", err)
+	}
+	if got := resolved(r, "audio", "Sound", "play()", false); got != nil {
+		t.Error("Include() included methods despite the conflict")
+	}
+
+	if err := r.Include(r); err != nil {
+		t.Errorf("Include() of the Registry itself returned %v", err)
+	}
+
+}
+
+func TestRegistryWildcards(t *testing.T) {
+
+	r := NewRegistry()
+	r.Register("engine/input", "Input", "pressed(_)", true, returning("registered"))
+
+	r.AddWildcard("engine/*", "*", func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction {
+		if signature == "skip()" {
+			return nil
+		}
+		return returning("engine wildcard")
+	})
+	r.AddWildcard("*", "Input", func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction {
+		return returning("input wildcard")
+	})
+	r.AddWildcard("engine/*", "Input", func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction {
+		return returning("engine input wildcard")
+	})
+	r.AddFallback(func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction {
+		return returning("fallback")
+	})
+
+	tests := []struct {
+		module, className, signature string
+		want                         any
+	}{
+		{"engine/input", "Input", "pressed(_)", "registered"},        // Registered methods come first
+		{"engine/input", "Input", "released(_)", "engine wildcard"},  // Then wildcards, in order
+		{"engine/input", "Input", "skip()", "engine input wildcard"}, // Or the next one, if a wildcard has nothing
+		{"game", "Input", "pressed(_)", "input wildcard"},
+		{"engine/audio/mixer", "Mixer", "play()", "fallback"}, // "*" doesn't match across slashes
+		{"game", "Player", "jump()", "fallback"},
+	}
+
+	for _, test := range tests {
+		if got := resolved(r, test.module, test.className, test.signature, true); got != test.want {
+			t.Errorf("Resolve(%q, %q, %q) = %v; want %v", test.module, test.className, test.signature, got, test.want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("AddWildcard() with a malformed pattern didn't panic")
+		}
+	}()
+	r.AddWildcard("[", "*", nil)
+
+}
+
+func TestRegistryMethods(t *testing.T) {
+
+	r := NewRegistry()
+	r.Register("engine", "Input", "released(_)", true, returning(nil))
+	r.Register("audio", "Sound", "play()", false, returning(nil))
+	r.Register("engine", "Input", "pressed(_)", true, returning(nil))
+	r.AddWildcard("*", "*", func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction {
+		return nil
+	})
+
+	want := []ForeignMethodKey{
+		{Module: "audio", Class: "Sound", Signature: "play()"},
+		{Module: "engine", Class: "Input", Signature: "pressed(_)", IsStatic: true},
+		{Module: "engine", Class: "Input", Signature: "released(_)", IsStatic: true},
+	}
+
+	if got := r.Methods(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Methods() = %v; want %v", got, want)
+	}
+
+}
+
+func TestRegistryPrecedence(t *testing.T) {
+
+	registry := NewRegistry()
+	registry.Register("main", "Game", "name", true, returning("registry"))
+	registry.Register("main", "Game", "score", true, returning("registry"))
+
+	fake, vm := newFakeVM(t, func(cfg Config) Config {
+		return cfg.WithRegistry(registry).WithForeignMethodResolver(echo(func(args []any) any { return "resolver" }))
+	})
+
+	vm.DefineModule("main").Class("Game").Static("name", returning("defined"))
+
+	tests := []struct {
+		signature string
+		want      string
+	}{
+		{"name", "defined"},   // Defined from Go, over the registry
+		{"score", "registry"}, // From the registry, over the resolver
+		{"level", "resolver"},
+	}
+
+	for _, test := range tests {
+		if got, err := fake.CallForeign(vm, "main", "Game", test.signature, true); err != nil || got != test.want {
+			t.Errorf("CallForeign(%q) = %v, %v; want %v", test.signature, got, err, test.want)
+		}
+	}
+
+}
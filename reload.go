@@ -0,0 +1,235 @@
+package wrengo
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"sync"
+)
+
+// Reloader reloads scripts while they're being worked on. A module can't be run again in a VM, so when the module
+// files change, the Reloader rebuilds the VM instead: it creates a new VM with the same configuration, user data
+// and modules defined from Go, runs the entry modules in it again, and moves the CallHandles created through the
+// Reloader over to it, before freeing the old VM.
+//
+//	vm := wrengo.NewVM(config)
+//	vm.DefineModule("engine")...
+//	reloader, err := wrengo.NewReloader(vm, os.DirFS("scripts"), "main.wren")
+//	...
+//	update, err := reloader.CallHandle("main", "Game", "update(_)")
+//	...
+//	for { // The game loop
+//		if _, err := reloader.Poll(); err != nil {
+//			log.Println(err) // The old VM keeps running until the scripts are fixed
+//		}
+//		update.Call(dt)
+//	}
+//
+// The VM is only rebuilt between calls into it, so the Reloader should be polled from the goroutine that uses the
+// VM; CallHandles created through it shouldn't be called from other goroutines while it's polled.
+type Reloader struct {
+	fsys    fs.FS
+	entries []string
+	migrate func(oldVM, newVM *VM) error
+
+	mu      sync.Mutex
+	vm      *VM
+	handles []*CallHandle
+	stamps  map[string]moduleStamp
+}
+
+// moduleStamp is what a Reloader looks at to tell whether a module file has changed.
+type moduleStamp struct {
+	modTime int64 // In nanoseconds
+	size    int64
+}
+
+// NewReloader runs the entry modules, which are files in fsys (see VM.RunFile()), in the VM, and returns a Reloader
+// that rebuilds the VM whenever the ".wren" files in fsys change. The VM should be freshly created, with any modules
+// it needs defined from Go; the Reloader owns it from then on, so use Reloader.VM() to get the current VM.
+func NewReloader(vm *VM, fsys fs.FS, entries ...string) (*Reloader, error) {
+
+	stamps, err := moduleStamps(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if err := vm.RunFile(fsys, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &Reloader{
+		fsys:    fsys,
+		entries: entries,
+		vm:      vm,
+		stamps:  stamps,
+	}
+
+	return r, nil
+
+}
+
+// OnReload sets a function that's called on each reload, once the new VM has run the entry modules, and before the
+// old VM is freed. It can carry state from the old VM over to the new one (say, the player's position); if it
+// returns an error, the reload is abandoned, and the old VM is kept. It mustn't call the Reloader's methods.
+func (r *Reloader) OnReload(migrate func(oldVM, newVM *VM) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.migrate = migrate
+}
+
+// VM returns the current VM.
+func (r *Reloader) VM() *VM {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.vm
+}
+
+// CallHandle creates a CallHandle in the current VM, like VM.CallHandle() does, which is moved over to the new VM
+// on each reload.
+func (r *Reloader) CallHandle(module, object, signature string) (*CallHandle, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	handle, err := r.vm.CallHandle(module, object, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	r.handles = append(r.handles, handle)
+	return handle, nil
+
+}
+
+// Poll checks whether any of the ".wren" files in the Reloader's file system have changed (or been added or
+// removed) since the last time, by their modification times and sizes, and reloads the VM if they have, returning
+// true. If the reload fails, Poll returns its error (see Reload()), and the reload isn't tried again until the files
+// change again.
+func (r *Reloader) Poll() (bool, error) {
+
+	stamps, err := moduleStamps(r.fsys)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	changed := !maps.Equal(stamps, r.stamps)
+	r.stamps = stamps
+	r.mu.Unlock()
+
+	if !changed {
+		return false, nil
+	}
+
+	if err := r.Reload(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+
+}
+
+// Reload rebuilds the VM, whether or not the module files have changed. If the entry modules fail to run in the new
+// VM, the objects the Reloader's CallHandles call no longer exist in it, or the function set with OnReload() returns
+// an error, the reload is abandoned and the error is returned, with the old VM kept.
+func (r *Reloader) Reload() error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.vm
+
+	unlock, err := old.lock()
+	if err != nil {
+		return err
+	}
+	if old.freed {
+		unlock()
+		return ErrVMFreed
+	}
+	modules := maps.Clone(old.modules)
+	userData := old.UserData()
+	handles := []*CallHandle{}
+	for _, handle := range r.handles {
+		if !handle.released {
+			handles = append(handles, handle)
+		}
+	}
+	unlock()
+
+	vm, err := old.lib.CreateVM(old.config)
+	if err != nil {
+		return err
+	}
+	vm.modules = modules
+	vm.SetUserData(userData)
+
+	abandon := func(err error) error {
+		vm.Free()
+		return err
+	}
+
+	for _, entry := range r.entries {
+		if err := vm.RunFile(r.fsys, entry); err != nil {
+			return abandon(err)
+		}
+	}
+
+	for _, handle := range handles {
+		if !vm.HasVariable(handle.module, handle.object) {
+			return abandon(fmt.Errorf("error reloading; '%s' no longer exists in '%s'", handle.object, handle.module))
+		}
+	}
+
+	if r.migrate != nil {
+		if err := r.migrate(old, vm); err != nil {
+			return abandon(err)
+		}
+	}
+
+	unlock, err = old.lock()
+	if err != nil {
+		return abandon(err)
+	}
+	for _, handle := range handles {
+		handle.rebind(vm)
+	}
+	unlock()
+
+	r.handles = handles
+	r.vm = vm
+	old.Free()
+
+	return nil
+
+}
+
+// Close frees the current VM.
+func (r *Reloader) Close() error {
+	return r.VM().Free()
+}
+
+// moduleStamps returns the stamps of the ".wren" files in the file system, by path.
+func moduleStamps(fsys fs.FS) (map[string]moduleStamp, error) {
+
+	stamps := map[string]moduleStamp{}
+
+	err := fs.WalkDir(fsys, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(filePath) != ".wren" {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stamps[filePath] = moduleStamp{modTime: info.ModTime().UnixNano(), size: info.Size()}
+		return nil
+	})
+
+	return stamps, err
+
+}
@@ -28,74 +28,84 @@ func BytePtrToString(p *byte) string {
 // while the other slots contains the arguments. This is how data is transferred from C (go) to Wren and back.
 // When a Wren function calls a method and gets a response, the response is set to slot 0; in other words, if a Go function
 // returns a value, putting it into slot 0 binds it.
-func goValueToSlot(vmHandle uintptr, slot int, arg any) bool {
+//
+// Lists and maps are built (and read) element by element through extra "scratch" slots. These are allocated past
+// the VM's current slots, so converting one argument never overwrites the ones after it.
+func (lib *Library) goValueToSlot(vmHandle uintptr, slot int, arg any) bool {
+	return lib.goValueToSlotScratch(vmHandle, slot, lib.scratchSlot(vmHandle, slot), arg)
+}
+
+func (lib *Library) goValueToSlotScratch(vmHandle uintptr, slot, scratch int, arg any) bool {
 
 	switch a := arg.(type) {
 	case bool:
-		setSlotBool(vmHandle, slot, a)
+		lib.backend.SetSlotBool(vmHandle, slot, a)
 		return true
 	case int:
-		setSlotDouble(vmHandle, slot, float64(a))
+		lib.backend.SetSlotDouble(vmHandle, slot, float64(a))
 		return true
 	case int32:
-		setSlotDouble(vmHandle, slot, float64(a))
+		lib.backend.SetSlotDouble(vmHandle, slot, float64(a))
 		return true
 	case int64:
-		setSlotDouble(vmHandle, slot, float64(a))
+		lib.backend.SetSlotDouble(vmHandle, slot, float64(a))
 		return true
 	case float32:
-		setSlotDouble(vmHandle, slot, float64(a))
+		lib.backend.SetSlotDouble(vmHandle, slot, float64(a))
 		return true
 	case float64:
-		setSlotDouble(vmHandle, slot, a)
+		lib.backend.SetSlotDouble(vmHandle, slot, a)
 		return true
 	case uint:
-		setSlotDouble(vmHandle, slot, float64(a))
+		lib.backend.SetSlotDouble(vmHandle, slot, float64(a))
 		return true
 	case uint8:
-		setSlotDouble(vmHandle, slot, float64(a))
+		lib.backend.SetSlotDouble(vmHandle, slot, float64(a))
 		return true
 	case uint16:
-		setSlotDouble(vmHandle, slot, float64(a))
+		lib.backend.SetSlotDouble(vmHandle, slot, float64(a))
 		return true
 	case uint32:
-		setSlotDouble(vmHandle, slot, float64(a))
+		lib.backend.SetSlotDouble(vmHandle, slot, float64(a))
 		return true
 	case uint64:
-		setSlotDouble(vmHandle, slot, float64(a))
+		lib.backend.SetSlotDouble(vmHandle, slot, float64(a))
 		return true
 	case string:
-		setSlotString(vmHandle, slot, a)
+		lib.backend.SetSlotString(vmHandle, slot, a)
 		return true
 	case []byte:
-		setSlotBytes(vmHandle, slot, uintptr(unsafe.Pointer(&a)), len(a))
+		lib.backend.SetSlotBytes(vmHandle, slot, a)
 		return true
 	case nil:
-		setSlotNull(vmHandle, slot)
+		lib.backend.SetSlotNull(vmHandle, slot)
 		return true
 	case []any:
-		setSlotNewList(vmHandle, slot)
+		lib.backend.SetSlotNewList(vmHandle, slot)
+		lib.backend.EnsureSlots(vmHandle, scratch+1)
 		for _, i := range a {
-			if !goValueToSlot(vmHandle, slot+1, i) {
+			// Put the element in the scratch slot, and from there into the list
+			if !lib.goValueToSlotScratch(vmHandle, scratch, scratch+1, i) {
 				return false
 			}
-			insertSlotListElement(vmHandle, slot, -1, slot+1)
+			lib.backend.InsertInList(vmHandle, slot, -1, scratch)
 		}
 		return true
 	case map[any]any:
-		setSlotNewMap(vmHandle, slot)
+		lib.backend.SetSlotNewMap(vmHandle, slot)
+		lib.backend.EnsureSlots(vmHandle, scratch+2)
 		for k, v := range a {
 
-			// Put the key in the current slot
-			if !goValueToSlot(vmHandle, slot+1, k) {
+			// Put the key in the first scratch slot
+			if !lib.goValueToSlotScratch(vmHandle, scratch, scratch+2, k) {
 				return false
 			}
 
-			// The value in the next slot
-			if !goValueToSlot(vmHandle, slot+2, v) {
+			// The value in the next one
+			if !lib.goValueToSlotScratch(vmHandle, scratch+1, scratch+2, v) {
 				return false
 			}
-			setSlotMapValue(vmHandle, slot, slot+1, slot+2) // Put it in the map in the current slot
+			lib.backend.SetMapValue(vmHandle, slot, scratch, scratch+1) // Put it in the map in the current slot
 		}
 		return true
 	}
@@ -104,44 +114,57 @@ func goValueToSlot(vmHandle uintptr, slot int, arg any) bool {
 
 }
 
-func slotValueToGo(vm uintptr, slot int) any {
+func (lib *Library) slotValueToGo(vm uintptr, slot int) any {
+	return lib.slotValueToGoScratch(vm, slot, lib.scratchSlot(vm, slot))
+}
+
+// scratchSlot returns the first slot past both the VM's current slots and the given one.
+func (lib *Library) scratchSlot(vm uintptr, slot int) int {
+	return max(lib.backend.GetSlotCount(vm), slot+1)
+}
+
+func (lib *Library) slotValueToGoScratch(vm uintptr, slot, scratch int) any {
 
-	t := SlotType(getSlotType(vm, slot))
+	t := SlotType(lib.backend.GetSlotType(vm, slot))
 
 	switch t {
 	case SlotTypeBool:
-		// args = append(args, getSlotBool(vm, slot))
-		return getSlotBool(vm, slot)
+		// args = append(args, lib.backend.GetSlotBool(vm, slot))
+		return lib.backend.GetSlotBool(vm, slot)
 	case SlotTypeNumber:
-		return getSlotDouble(vm, slot)
+		return lib.backend.GetSlotDouble(vm, slot)
 	case SlotTypeNull:
 		return nil
 	case SlotTypeString:
-		return getSlotString(vm, slot)
+		return lib.backend.GetSlotString(vm, slot)
+	case SlotTypeForeign:
+		return lib.foreignSlotValue(vm, slot)
 	case SlotTypeList:
-		listCount := getSlotListCount(vm, slot)
+		listCount := lib.backend.GetListCount(vm, slot)
 		list := []any{}
+		lib.backend.EnsureSlots(vm, scratch+1)
 		for listIndex := range listCount {
-			// Put the element in the next slot
-			getSlotListElement(vm, slot, listIndex, slot+1)
+			// Put the element in the scratch slot
+			lib.backend.GetListElement(vm, slot, listIndex, scratch)
 			// And parse it from there; this makes sure we're not overwriting slots (which would make it crash)
-			list = append(list, slotValueToGo(vm, slot+1))
+			list = append(list, lib.slotValueToGoScratch(vm, scratch, scratch+1))
 		}
 		return list
 	case SlotTypeMap:
-		mapCount := getSlotMapCount(vm, slot)
+		mapCount := lib.backend.GetMapCount(vm, slot)
 		mapping := map[any]any{}
+		lib.backend.EnsureSlots(vm, scratch+2)
 		for n := range mapCount {
-			getSlotMapKey(vm, slot, n, slot+1)
-			key := slotValueToGo(vm, slot+1)
+			lib.backend.GetMapKey(vm, slot, n, scratch)
+			key := lib.slotValueToGoScratch(vm, scratch, scratch+2)
 
-			getSlotMapValue(vm, slot, slot+1, slot+2)
-			value := slotValueToGo(vm, slot+2)
+			lib.backend.GetMapValue(vm, slot, scratch, scratch+1)
+			value := lib.slotValueToGoScratch(vm, scratch+1, scratch+2)
 			mapping[key] = value
 		}
 		return mapping
 	default:
-		log.Println("Cannot parse argument of type %v", t)
+		log.Printf("Cannot parse argument of type %v", t)
 	}
 
 	return nil
@@ -0,0 +1,140 @@
+package wrengo
+
+import (
+	"context"
+	"errors"
+	"runtime"
+)
+
+// ErrVMInUse is returned when a VM is freed, or made to run code (with Run(), Eval() or CallHandle.Call()), from one
+// of its own foreign functions; Wren can't do either while it's running them.
+var ErrVMInUse = errors.New("error: virtual machine is in use; it can't be freed or run code while it's running")
+
+// ErrVMAbandoned is returned by calls into a VM that's still running a call that was given up on, as its context
+// was done before it returned (see VM.RunContext()); the VM can't be used until that call returns, if it ever does.
+var ErrVMAbandoned = errors.New("error: virtual machine is still running a call that was given up on")
+
+// vmResources are what has to be released once a VM is freed. They're kept apart from the VM, so that they can
+// still be released once it has become unreachable without being freed.
+type vmResources struct {
+	lib    *Library
+	handle uintptr
+	output *scriptOutput
+	leak   uint64
+}
+
+func (vm *VM) resources() vmResources {
+	return vmResources{lib: vm.lib, handle: vm.handle, output: vm.output, leak: vm.leak}
+}
+
+func (r vmResources) release() {
+	r.lib.backend.FreeVM(r.handle)
+	if r.output != nil {
+		r.output.close()
+	}
+	r.lib.vmFreed()
+}
+
+// cleanUpVM frees a VM that became unreachable without being freed.
+func cleanUpVM(r vmResources) {
+	r.release()
+	leaks.collected(r.leak)
+}
+
+// weakCallback returns a callback for the Backend that calls fn with the VM, while only holding a weak pointer to
+// it, as the Backend keeps its callbacks in tables that would otherwise keep the VM reachable forever.
+func (vm *VM) weakCallback(fn func(vm *VM, handle uintptr)) func(handle uintptr) {
+	self := vm.self
+	return func(handle uintptr) {
+		if vm := self.Value(); vm != nil {
+			fn(vm, handle)
+		}
+	}
+}
+
+// lock locks the VM for a call from Go, returning the function that unlocks it. Wren VMs can only run one thing at
+// a time, so calls from several goroutines take turns.
+//
+// While the VM is running one of its foreign functions (or another Go function it calls, like the error handler),
+// the call that's running it holds the lock, so calls into the VM from the thread running that function don't lock
+// it again. Calls from other goroutines wait for the lock, like any other; a foreign function that hands its work
+// to another goroutine that calls into the VM, and waits for it, therefore waits forever.
+//
+// Rather than wait for a call that was given up on (see VM.RunContext()), which may never return, lock returns
+// ErrVMAbandoned, even to the foreign functions that call is running.
+func (vm *VM) lock() (func(), error) {
+	return vm.lockContext(context.Background())
+}
+
+// lockContext locks the VM like lock() does, but stops waiting once the context is done, returning ctx.Err().
+func (vm *VM) lockContext(ctx context.Context) (func(), error) {
+
+	vm.abandonLock.Lock()
+	abandoned := vm.abandoned
+	vm.abandonLock.Unlock()
+
+	select {
+	case <-abandoned:
+		return nil, ErrVMAbandoned
+	default:
+	}
+
+	if vm.reentered() {
+		return func() {}, nil
+	}
+
+	select {
+	case vm.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-abandoned:
+		// The call may have returned since
+		select {
+		case vm.sem <- struct{}{}:
+		default:
+			return nil, ErrVMAbandoned
+		}
+	}
+
+	vm.runPending()
+	return vm.unlock, nil
+
+}
+
+// tryLock locks the VM if it's not locked already, returning false if it is.
+func (vm *VM) tryLock() bool {
+	select {
+	case vm.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (vm *VM) unlock() {
+	<-vm.sem
+}
+
+// reentered returns true if the VM is being called from one of its own foreign functions, rather than from another
+// goroutine while it's running one.
+func (vm *VM) reentered() bool {
+	return vm.callbacks.Load() > 0 && vm.owner.Load() == currentThread()
+}
+
+// callBack runs fn, a Go function the VM calls while it's locked, allowing it to call back into the VM. The function
+// runs locked to the thread it's called on, which tells its calls into the VM apart from those of other goroutines.
+func (vm *VM) callBack(fn func()) {
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	outer := vm.owner.Swap(currentThread())
+	vm.callbacks.Add(1)
+	defer func() {
+		vm.callbacks.Add(-1)
+		vm.owner.Store(outer)
+	}()
+
+	fn()
+
+}
@@ -1,15 +1,18 @@
 package wrengo
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
-	"unsafe"
-
-	"github.com/ebitengine/purego"
+	"sync"
+	"sync/atomic"
+	"weak"
 )
 
 type SlotType int
@@ -27,171 +30,13 @@ const (
 
 // InterpretResultSuccess InterpretResult = iota
 var ErrCompileTime = errors.New("error compiling wren script")
-var ErrVMFreed = errors.New("error: virtual machine already freed")
-
-var initConfig func(uintptr)
-var newVM func(*Config) uintptr
-var interpret func(vm uintptr, moduleName, text string) int
-var freeVM func(vm uintptr)
-
-var ensureSlots func(vm uintptr, slotCount int)
-var getSlotCount func(vm uintptr)
-
-var setSlotBool func(vm uintptr, slot int, value bool)
-var setSlotDouble func(vm uintptr, slot int, value float64)
-var setSlotNull func(vm uintptr, slot int)
-var setSlotBytes func(vm uintptr, slot int, bytes uintptr, length int)
-var setSlotString func(vm uintptr, slot int, text string)
-
-var getSlotBool func(vm uintptr, slot int) bool
-var getSlotDouble func(vm uintptr, slot int) float64
-var getSlotString func(vm uintptr, slot int) string
-var getSlotBytes func(vm uintptr, slot int, length int) *byte
-
-var setSlotNewList func(vm uintptr, slot int) int
-var getSlotListCount func(vm uintptr, slot int) int
-var setSlotListElement func(vm uintptr, listSlot, index, elementSlot int)
-var insertSlotListElement func(vm uintptr, listSlot, index, elementSlot int)
-var getSlotListElement func(vm uintptr, listSlot, index, elementSlot int)
-
-var setSlotNewMap func(vm uintptr, slot int) int
-var getSlotMapCount func(vm uintptr, mapSlot int) int
-var setSlotMapValue func(vm uintptr, mapSlot, keySlot, valueSlot int)
-var removeSlotMapValue func(vm uintptr, mapSlot, keySlot, removedValueSlot int)
-var getSlotMapContainsKey func(vm uintptr, slot int) bool
-var getSlotMapKey func(vm uintptr, mapSlot, keyIndex, targetSlot int)
-var getSlotMapValue func(vm uintptr, mapSlot, keySlot, valueSlot int)
-
-var getSlotType func(vm uintptr, slot int) int
-
-var getSlotHandle func(vm uintptr, slot int) uintptr
-var makeCallHandle func(vm uintptr, signature string) uintptr
-var call func(vm uintptr, handle uintptr) int
-var releaseCallHandle func(vm uintptr, handle uintptr)
-
-var getVariable func(vm uintptr, module, name string, slot int)
-var hasVariable func(vm uintptr, module, name string) bool
-var hasModule func(vm uintptr, module string) bool
-
-var getVersionNumber func() int
-
-var initialized bool
-
-// Returns the version number of the scripting engine.
-func VersionNumber() (int, int, int) {
-	versionNumber := getVersionNumber()
-	major := int(versionNumber / 1000000)
-	minor := int(versionNumber / 1000)
-	patch := versionNumber - (major * 100000) - (minor * 1000)
-	return major, minor, patch
-}
-
-// Init initializes the Wren-Go bindings using the passed shared library filepath.
-// The path is, by default, relative to the executable, in the current working directory.
-// The function automatically loads libraries using the OS and architecture hierarchy from the original
-// DLL / library download.
-func Init(libraryPath string) error {
-
-	lib, err := loadLibrary(libraryPath)
-	if err != nil {
-		return err
-	}
-
-	purego.RegisterLibFunc(&getVersionNumber, lib, "wrenGetVersionNumber")
-	purego.RegisterLibFunc(&initConfig, lib, "wrenInitConfiguration")
-	purego.RegisterLibFunc(&newVM, lib, "wrenNewVM")
-	purego.RegisterLibFunc(&interpret, lib, "wrenInterpret")
-	purego.RegisterLibFunc(&freeVM, lib, "wrenFreeVM")
-
-	purego.RegisterLibFunc(&makeCallHandle, lib, "wrenMakeCallHandle")
-	purego.RegisterLibFunc(&call, lib, "wrenCall")
-	purego.RegisterLibFunc(&releaseCallHandle, lib, "wrenReleaseHandle")
-
-	purego.RegisterLibFunc(&getVariable, lib, "wrenGetVariable")
-	purego.RegisterLibFunc(&hasVariable, lib, "wrenHasVariable")
-	purego.RegisterLibFunc(&hasModule, lib, "wrenHasModule")
-
-	purego.RegisterLibFunc(&ensureSlots, lib, "wrenEnsureSlots")
-	purego.RegisterLibFunc(&getSlotCount, lib, "wrenGetSlotCount")
-
-	purego.RegisterLibFunc(&setSlotBool, lib, "wrenSetSlotBool")
-	purego.RegisterLibFunc(&setSlotDouble, lib, "wrenSetSlotDouble")
-	purego.RegisterLibFunc(&setSlotNull, lib, "wrenSetSlotNull")
-	purego.RegisterLibFunc(&setSlotBytes, lib, "wrenSetSlotBytes")
-	purego.RegisterLibFunc(&setSlotString, lib, "wrenSetSlotString")
-
-	purego.RegisterLibFunc(&setSlotNewList, lib, "wrenSetSlotNewList")
-	purego.RegisterLibFunc(&setSlotListElement, lib, "wrenSetListElement")
-	purego.RegisterLibFunc(&insertSlotListElement, lib, "wrenInsertInList")
-	purego.RegisterLibFunc(&getSlotListCount, lib, "wrenGetListCount")
-	purego.RegisterLibFunc(&getSlotListElement, lib, "wrenGetListElement")
-
-	purego.RegisterLibFunc(&setSlotNewMap, lib, "wrenSetSlotNewMap")
-	purego.RegisterLibFunc(&setSlotMapValue, lib, "wrenSetMapValue")
-	purego.RegisterLibFunc(&removeSlotMapValue, lib, "wrenRemoveMapValue")
-	purego.RegisterLibFunc(&getSlotMapCount, lib, "wrenGetMapCount")
-	purego.RegisterLibFunc(&getSlotMapContainsKey, lib, "wrenGetMapContainsKey")
-	purego.RegisterLibFunc(&getSlotMapKey, lib, "wrenGetMapKey")
-	purego.RegisterLibFunc(&getSlotMapValue, lib, "wrenGetMapValue")
-
-	purego.RegisterLibFunc(&getSlotBool, lib, "wrenGetSlotBool")
-	purego.RegisterLibFunc(&getSlotDouble, lib, "wrenGetSlotDouble")
-	purego.RegisterLibFunc(&getSlotBytes, lib, "wrenGetSlotBytes")
-	purego.RegisterLibFunc(&getSlotString, lib, "wrenGetSlotString")
-	purego.RegisterLibFunc(&getSlotType, lib, "wrenGetSlotType")
-
-	return nil
-
-}
-
-// InitFromDirectory initializes the scripting bindings using the libraries in the given
-// directory, automatically loading the correct one for the current platform if it's properly named.
-func InitFromDirectory(libraryBaseDirectoryPath string) error {
-
-	if initialized {
-		return nil
-	}
 
-	osName := ""
-
-	switch runtime.GOOS {
-	case "darwin":
-		osName = "wren_macos"
-	case "linux":
-		osName = "wren_linux"
-	case "windows":
-		osName = "wren_win"
-	}
-
-	archFolder := ""
-
-	switch runtime.GOARCH {
-	case "386":
-		archFolder = "_x86"
-	case "amd64":
-		archFolder = "_x86_64"
-	case "arm":
-		archFolder = "_arm"
-	case "arm64":
-		archFolder = "_arm64"
-	}
-
-	filename := ""
-
-	switch runtime.GOOS {
-	case "linux":
-		filename = ".so"
-	case "darwin":
-		filename = ".dylib"
-	case "windows":
-		filename = ".dll"
-
-	}
-
-	dllPath := filepath.Join(filepath.Clean(libraryBaseDirectoryPath), strings.Join([]string{osName, archFolder, filename}, ""))
-
-	return Init(dllPath)
-}
+// ErrVMFreed is returned by every method of a VM (or of a CallHandle created from it) that returns an error, once
+// the VM has been freed. The methods that don't return an error act as though the VM were empty: Variable()
+// returns nil, HasVariable() and HasModule() return false, and so on.
+var ErrVMFreed = errors.New("error: virtual machine already freed")
+var ErrHandleReleased = errors.New("error: call handle already released")
+var ErrUnsupported = errors.New("error: function not supported by the loaded Wren library")
 
 // GoForeignFunction represents a Go function that is called from Wren.
 // args represents the arguments that were supplied from Wren through the method or function call, and
@@ -199,52 +44,31 @@ func InitFromDirectory(libraryBaseDirectoryPath string) error {
 type GoForeignFunction func(vm *VM, args []any) any
 
 type Config struct {
-	reallocateFn        uintptr
-	resolveModuleFn     uintptr
-	loadModuleFn        uintptr
-	bindForeignMethodFn uintptr
-	bindForeignClassFn  uintptr
-	writeFn             uintptr
-	errorFn             uintptr
+	resolveModuleFn     func(vm uintptr, importer, name string) string
+	moduleLoaders       []ModuleLoader
+	bindForeignMethodFn func(vm *VM, module, className string, isStatic bool, signature string) func(vm uintptr)
+	bindForeignClassFn  func(vm *VM, module, className string) *ForeignClass
+	registry            *Registry
+	writer              io.Writer
+	errorHandler        func(vm *VM, err error)
 	initialHeapSize     int
 	minHeapSize         int
 	heapGrowthPercent   int
-	userData            uintptr
+	memoryLimit         int
+	trackMemory         bool
+	userData            any
 	SlotNum             int // Number of slots for variables; by default, set to 100
 }
 
 // WithModuleLoaderFromFS sets the Wren VM to use a file system to load and import Wren modules.
-//
-// This can only be set once per Config.
+// It's a shortcut for WithModuleLoaders(FSLoader{FS: filesys}).
 func (cfg Config) WithModuleLoaderFromFS(filesys fs.FS) Config {
 
-	if cfg.loadModuleFn != 0 {
+	if filesys == nil {
 		return cfg
 	}
 
-	if filesys != nil {
-		cfg.loadModuleFn = purego.NewCallback(func(vm uintptr, modName *byte) *byte {
-			modNameString := BytePtrToString(modName)
-
-			if filepath.Ext(filepath.Base(modNameString)) != ".wren" {
-				modNameString += ".wren"
-			}
-
-			res, err := fs.ReadFile(filesys, modNameString)
-
-			if err != nil {
-				// We don't need to output an error; Wren will say it couldn't load the module.
-				// println("WrenVM: Module Loading:", err.Error())
-				return nil
-			}
-
-			return &res[0]
-
-		})
-
-	}
-
-	return cfg
+	return cfg.WithModuleLoaders(FSLoader{FS: filesys})
 
 }
 
@@ -253,128 +77,294 @@ func (cfg Config) WithModuleLoaderFromFS(filesys fs.FS) Config {
 // written in Go that does something and that can return a value, depending on the module, classname,
 // signature, and staticness provided.
 //
-// This can only be set once per Config.
+// This can only be set once per Config; to combine the bindings of several packages, use a Registry (see
+// WithRegistry()).
 func (cfg Config) WithForeignMethodResolver(resolver func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction) Config {
 
-	if cfg.bindForeignMethodFn != 0 {
+	if cfg.bindForeignMethodFn != nil || resolver == nil {
 		return cfg
 	}
 
-	cfg.bindForeignMethodFn = purego.NewCallback(func(vm uintptr, module, className *byte, isStatic bool, signature *byte) uintptr {
+	cfg.bindForeignMethodFn = func(vm *VM, module, className string, isStatic bool, signature string) func(vm uintptr) {
+
+		out := resolver(vm, module, className, signature, isStatic)
+
+		if out == nil {
+			return nil
+		}
 
-		if resolver != nil {
+		return vm.foreignMethod(signature, out)
 
-			sigString := BytePtrToString(signature)
+	}
 
-			out := resolver(vmstoVMs[vm], BytePtrToString(module), BytePtrToString(className), sigString, isStatic)
+	return cfg
 
-			if out != nil {
+}
 
-				return purego.NewCallback(func(vm uintptr) {
+// foreignMethod wraps the Go function, so that Wren can call it as the foreign method with the given signature;
+// the arguments are converted to Go values, and the result back to a Wren value.
+func (vm *VM) foreignMethod(signature string, fn GoForeignFunction) func(handle uintptr) {
 
-					argCount := strings.Count(sigString, "_")
+	argCount := strings.Count(signature, "_")
 
-					args := []any{}
+	return vm.weakCallback(func(vm *VM, handle uintptr) {
 
-					for i := range argCount {
-						args = append(args, slotValueToGo(vm, i+1))
-					}
+		if vm.memoryLimitExceeded() {
+			vm.abortFiber(handle, vm.memoryLimitError())
+			return
+		}
 
-					res := out(vmstoVMs[vm], args)
-					if res != nil {
-						goValueToSlot(vm, 0, res)
-					}
-					return
-				})
-			}
+		if err := vm.contextDone(); err != nil {
+			vm.abortFiber(handle, err)
+			return
+		}
 
-			return uintptr(0)
+		args := []any{}
+
+		for i := range argCount {
+			args = append(args, vm.lib.slotValueToGo(handle, i+1))
 		}
-		// fmt.Println("bind function?")
-		test := func(vm uintptr) {
-			fmt.Println("this is a function???")
+
+		// Foreign methods can nest, so the receiver of the outer one is kept
+		outer := vm.receiver
+		vm.receiver = nil
+		if SlotType(vm.lib.backend.GetSlotType(handle, 0)) == SlotTypeForeign {
+			vm.receiver = vm.lib.foreignSlotValue(handle, 0)
+		}
+
+		var res any
+		vm.callBack(func() { res = fn(vm, args) })
+		vm.receiver = outer
+
+		if res != nil {
+			vm.lib.goValueToSlot(handle, 0, res)
 		}
-		return purego.NewCallback(test)
-		// return uintptr(unsafe.Pointer(&test))
 
 	})
 
+}
+
+// WithHeap sets the VM's garbage collection settings, in bytes: the heap size at which the first collection happens,
+// the size the heap never shrinks below between collections, and how much the heap may grow after a collection
+// before the next one, as a percentage of the memory still in use. A value of 0 keeps Wren's default (10MB, 1MB
+// and 50%, respectively).
+//
+// WithHeap panics if any of the values are negative, or if minHeapSize is larger than initialHeapSize.
+func (cfg Config) WithHeap(initialHeapSize, minHeapSize, heapGrowthPercent int) Config {
+
+	if initialHeapSize < 0 || minHeapSize < 0 || heapGrowthPercent < 0 {
+		panic(fmt.Errorf("error: invalid heap settings (%d, %d, %d%%); values can't be negative", initialHeapSize, minHeapSize, heapGrowthPercent))
+	}
+
+	if initialHeapSize > 0 && minHeapSize > initialHeapSize {
+		panic(fmt.Errorf("error: invalid heap settings; the minimum heap size (%d) is larger than the initial heap size (%d)", minHeapSize, initialHeapSize))
+	}
+
+	cfg.initialHeapSize = initialHeapSize
+	cfg.minHeapSize = minHeapSize
+	cfg.heapGrowthPercent = heapGrowthPercent
 	return cfg
 
 }
 
-// NewConfig creates a new configuration for creating a VM.
-func NewConfig() Config {
+// WithUserData sets a value for the VM to carry (for example, the game or world it scripts), so that foreign
+// functions can get it with VM.UserData() rather than from package-level variables. Each VM created from the
+// configuration starts out with the same value; use VM.SetUserData() to give a VM one of its own.
+func (cfg Config) WithUserData(data any) Config {
+	cfg.userData = data
+	return cfg
+}
 
-	wrenConfig := Config{}
+// withDefaultCallbacks sets the configuration's output and error callbacks.
+func (cfg Config) withDefaultCallbacks() Config {
 
-	initConfig(uintptr(unsafe.Pointer(&wrenConfig)))
+	cfg.writer = os.Stdout
 
-	wrenConfig.writeFn = purego.NewCallback(func(vm uintptr, text *byte) {
-		print(BytePtrToString(text))
-	})
+	cfg.errorHandler = printError
+
+	return cfg
+}
+
+// backendConfig returns the settings and callbacks the Backend needs to create the VM with this configuration.
+//
+// The callbacks only hold a weak pointer to the VM, as the Backend keeps them in tables that would otherwise keep the
+// VM reachable forever (see VM.Free()).
+func (cfg Config) backendConfig(vm *VM) *BackendConfig {
+
+	self := vm.self
+
+	backendConfig := &BackendConfig{
+		ResolveModule: func(_ uintptr, importer, name string) string {
+			return CanonicalModuleName(importer, name)
+		},
+		InitialHeapSize:   cfg.initialHeapSize,
+		MinHeapSize:       cfg.minHeapSize,
+		HeapGrowthPercent: cfg.heapGrowthPercent,
+		vm:                self,
+	}
 
-	wrenConfig.errorFn = purego.NewCallback(func(vm uintptr, errorType int, module *byte, line int, msg *byte) {
-		switch errorType {
-		case 0: // WREN_ERROR_COMPILE
-			fmt.Printf("[%s:%d] Compile %s\n", BytePtrToString(module), line, BytePtrToString(msg))
-		case 1: // WREN_ERROR_RUNTIME
-			fmt.Printf("[Runtime Error] %s\n", BytePtrToString(msg))
-			// fmt.Printf("[%s:%d] Runtime %s\n", BytePtrToString(module), line, BytePtrToString(msg))
-		case 2: // WREN_ERROR_STACK_TRACE
-			fmt.Printf("[%s:%d] in %s\n", BytePtrToString(module), line, BytePtrToString(msg))
+	backendConfig.Error = func(_ uintptr, errorType int, module string, line int, message string) {
+		if vm := self.Value(); vm != nil {
+			vm.reportError(errorType, module, line, message)
 		}
-	})
+	}
 
-	return wrenConfig
-}
+	backendConfig.LoadModule = func(_ uintptr, name string) []byte {
+		vm := self.Value()
+		if vm == nil {
+			return nil
+		}
+		if module, ok := vm.modules[name]; ok {
+			return []byte(module.Source())
+		}
+		return cfg.loadModule(name)
+	}
 
-type VM struct {
-	config Config
-	handle uintptr
-	freed  bool
-}
+	backendConfig.BindForeignMethod = func(_ uintptr, module, className string, isStatic bool, signature string) func(vm uintptr) {
+		vm := self.Value()
+		if vm == nil {
+			return nil
+		}
+		if fn := vm.definedForeignMethod(module, className, isStatic, signature); fn != nil {
+			return vm.foreignMethod(signature, fn)
+		}
+		if cfg.registry != nil {
+			if fn := cfg.registry.Resolve(vm, module, className, signature, isStatic); fn != nil {
+				return vm.foreignMethod(signature, fn)
+			}
+		}
+		if cfg.bindForeignMethodFn != nil {
+			return cfg.bindForeignMethodFn(vm, module, className, isStatic, signature)
+		}
+		return nil
+	}
+
+	if vm.lib.capabilities.ForeignClasses {
+
+		backendConfig.BindForeignClass = func(_ uintptr, module, className string) func(vm uintptr) {
+			vm := self.Value()
+			if vm == nil {
+				return nil
+			}
+			if class := vm.definedForeignClass(module, className); class != nil {
+				return vm.foreignAllocator(class)
+			}
+			if cfg.bindForeignClassFn != nil {
+				if class := cfg.bindForeignClassFn(vm, module, className); class != nil {
+					return vm.foreignAllocator(class)
+				}
+			}
+			// Wren's optional random module binds its own foreign class
+			if module == "random" {
+				return nil
+			}
+			return vm.missingForeignAllocator(module, className)
+		}
+
+		backendConfig.FinalizeForeign = finalizeForeign
+
+	}
 
-var vmstoVMs = map[uintptr]*VM{}
+	if cfg.trackMemory || cfg.memoryLimit > 0 {
+		backendConfig.Reallocate = vm.memory.reallocate
+	}
 
-// NewVM creates a new VM using the provided configuration.
-func NewVM(config Config) *VM {
-	vm := &VM{
-		config: config,
-		handle: uintptr(newVM(&config)),
+	if output := vm.output; output != nil {
+		backendConfig.Write = func(_ uintptr, text string) {
+			output.write(text)
+		}
 	}
-	vmstoVMs[vm.handle] = vm
-	return vm
+
+	return backendConfig
+
+}
+
+type VM struct {
+	lib     *Library
+	config  Config
+	handle  uintptr
+	output  *scriptOutput
+	memory  *memoryTracker
+	errs    *errorCollector
+	aborted *RuntimeError
+	modules map[string]*ModuleDefinition
+	// The Go value of the foreign object the running foreign method was called on, if any
+	receiver any
+	userData atomic.Pointer[any]
+	poolUses int // The number of times the VM has been acquired from its Pool
+	freed    bool
+	failed   bool // Whether a call into the VM has failed at runtime, which could leave it in any state
+
+	sem       chan struct{}  // Holds a value while the VM is locked
+	callbacks atomic.Int32   // The number of Go functions the VM is running, which can call back into it
+	owner     atomic.Uintptr // The thread running those functions (see callBack())
+
+	// The context of the running call into the VM, if it was given one
+	ctx context.Context
+	// abandoned is closed while a call into the VM that was given up on (see callContext()) is still running, and
+	// freeLater is set if the VM should be freed once it returns
+	abandonLock sync.Mutex
+	abandoned   chan struct{}
+	freeLater   bool
+
+	self    weak.Pointer[VM]
+	cleanup runtime.Cleanup    // Frees the VM if it becomes unreachable without being freed
+	leak    uint64             // The VM's ID in the leak tracker, if it's tracked
+	handles map[uintptr]uint64 // The call handles that haven't been released yet, with their IDs in the leak tracker
+
+	// Work left for the next time the VM is locked, as it was busy at the time (see later())
+	pendingLock sync.Mutex
+	pending     []func()
 }
 
 // Run compiles and evaluates the source text src and binds it to the given module name.
 // Once run, module cannot be run again, as the VM's state is persistent.
+// The module is registered under its canonical name (see CanonicalModuleName()), and relative imports in it are
+// resolved from its directory.
+//
+// If the source fails to compile, Run returns a *CompileError; if it aborts while running, a *RuntimeError.
 func (vm *VM) Run(moduleName, src string) error {
+	unlock, err := vm.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return vm.run(moduleName, src)
+}
+
+func (vm *VM) run(moduleName, src string) error {
 	if vm.freed {
 		return ErrVMFreed
 	}
-	res := interpret(vm.handle, moduleName, src)
+	// Wren isn't reentrant, so foreign functions can't make it run more code
+	if vm.reentered() {
+		return ErrVMInUse
+	}
+	moduleName = CanonicalModuleName("", moduleName)
+	done := vm.collectErrors(moduleName)
+	res := vm.lib.backend.Interpret(vm.handle, moduleName, src)
+	vm.flushOutput()
 
 	slotNum := vm.config.SlotNum
 	if slotNum <= 0 {
 		slotNum = 10000 // Default value; code assumes 100 slots
 	}
-	ensureSlots(vm.handle, slotNum)
+	vm.lib.backend.EnsureSlots(vm.handle, slotNum)
 
-	switch res {
-	case 0:
-		return nil
-	case 1:
-		return ErrCompileTime
-	default:
-		return fmt.Errorf("%s: runtime error running script", moduleName)
-	}
+	return done(res)
 }
 
 // RunFile evaluates a file, found at the provided filepath in the file system.
 // Once run, the file cannot be run again, as the VM's state is persistent.
+// The module is named after the filepath, so "./scripts/player.wren" is run as the "scripts/player" module.
 func (vm *VM) RunFile(fsys fs.FS, fpath string) error {
 
+	unlock, err := vm.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	if vm.freed {
 		return ErrVMFreed
 	}
@@ -384,23 +374,61 @@ func (vm *VM) RunFile(fsys fs.FS, fpath string) error {
 		return err
 	}
 
-	return vm.Run(fpath, string(src))
+	return vm.run(filepath.ToSlash(fpath), string(src))
 
 }
 
+// Free frees the VM. It returns ErrVMInUse if it's called from one of the VM's own foreign functions, and
+// ErrVMAbandoned if it's still running a call that was given up on (see RunContext()), in which case the VM is
+// freed once that call returns.
+//
+// A VM that becomes unreachable without being freed is freed automatically, some time after the garbage collector
+// notices, but VMs should still be freed as soon as they're no longer needed, as the garbage collector doesn't know
+// about the memory Wren allocates (see TrackLeaks()).
 func (vm *VM) Free() error {
+	unlock, err := vm.lock()
+	for err != nil {
+		if vm.freeOnReturn() {
+			return ErrVMAbandoned
+		}
+		// The call returned in the meantime
+		unlock, err = vm.lock()
+	}
+	defer unlock()
+	if vm.reentered() {
+		return ErrVMInUse
+	}
 	if vm.freed {
 		return ErrVMFreed
 	}
-	vm.freed = true
-	freeVM(vm.handle)
+	vm.free()
 	return nil
 }
 
+// free frees the VM, which must be locked.
+func (vm *VM) free() {
+	vm.runPending()
+	for handle, leak := range vm.handles {
+		vm.releaseHandle(handle)
+		leaks.untrack(leak)
+	}
+	vm.freed = true
+	vm.cleanup.Stop()
+	vm.resources().release()
+	leaks.untrack(vm.leak)
+}
+
+// flushOutput writes any script output left buffered once the VM returns to Go.
+func (vm *VM) flushOutput() {
+	if vm.output != nil {
+		vm.output.flush()
+	}
+}
+
 // CallHandle creates a call handle to the function or method with the name and
 // function signature defined of the object designated in the module provided.
-// The module is the filepath of the script file for VM.InterpretFilesystem() calls,
-// or the explicit module name for VM.Interpret() calls.
+// The module is the filepath of the script file for VM.RunFile() calls,
+// or the explicit module name for VM.Run() calls, in any form CanonicalModuleName() accepts.
 //
 // This can be used in two ways.
 //
@@ -412,43 +440,157 @@ func (vm *VM) Free() error {
 // You can also use it on getters, setters, and static functions.
 func (vm *VM) CallHandle(module, object, signature string) (*CallHandle, error) {
 
+	unlock, err := vm.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if vm.freed {
+		return nil, ErrVMFreed
+	}
+
 	signature = strings.ReplaceAll(signature, " ", "")
+	module = CanonicalModuleName("", module)
 
-	if !hasVariable(vm.handle, module, object) {
+	if !vm.hasVariable(module, object) {
 		return nil, fmt.Errorf("error getting a handle for '%s' in '%s'; does the module and object exist?", object, module)
 	}
 
 	handle := &CallHandle{
-		vm:       vm,
-		handle:   makeCallHandle(vm.handle, signature),
 		argCount: strings.Count(signature, "_"),
 		callName: signature,
 		object:   object,
 		module:   module,
+		leak:     leaks.track("CallHandle"),
 	}
 
+	vm.bindCallHandle(handle)
+
 	return handle, nil
 }
 
+// bindCallHandle makes the Wren handle for the CallHandle's signature in the VM.
+func (vm *VM) bindCallHandle(w *CallHandle) {
+
+	w.vm = vm
+	w.handle = vm.lib.backend.MakeCallHandle(vm.handle, w.callName)
+	w.cleanup = runtime.AddCleanup(w, cleanUpCallHandle, callHandleResources{vm: vm, handle: w.handle, leak: w.leak})
+
+	if vm.handles == nil {
+		vm.handles = map[uintptr]uint64{}
+	}
+	vm.handles[w.handle] = w.leak
+
+}
+
+// rebind moves the CallHandle to another VM, releasing its handle in the VM it was created in, which must be locked
+// (see Reloader). The other VM mustn't be in use yet.
+func (w *CallHandle) rebind(vm *VM) {
+
+	if w.released {
+		return
+	}
+
+	w.cleanup.Stop()
+	w.vm.releaseHandle(w.handle)
+
+	vm.sem <- struct{}{}
+	defer vm.unlock()
+	vm.bindCallHandle(w)
+
+}
+
 // var i = 0
 
 // Variable looks up the object name in the specified module; if it exists, it attempts to parse it to a Go object.
+// It returns nil if the variable doesn't exist, or if the VM has been freed; use LookupVariable() to tell those apart.
 func (vm *VM) Variable(module, objectName string) any {
-	if vm.HasVariable(module, objectName) {
-		getVariable(vm.handle, module, objectName, 99)
-		return slotValueToGo(vm.handle, 99)
+	value, _ := vm.LookupVariable(module, objectName)
+	return value
+}
+
+// LookupVariable is like Variable(), but returns ErrVMFreed if the VM has been freed, and an error if the variable
+// doesn't exist, rather than nil.
+func (vm *VM) LookupVariable(module, objectName string) (any, error) {
+
+	unlock, err := vm.lock()
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	defer unlock()
+
+	if vm.freed {
+		return nil, ErrVMFreed
+	}
+
+	module = CanonicalModuleName("", module)
+
+	if !vm.hasVariable(module, objectName) {
+		return nil, fmt.Errorf("error getting '%s' in '%s'; does the module and variable exist?", objectName, module)
+	}
+
+	vm.lib.backend.EnsureSlots(vm.handle, 100)
+	vm.lib.backend.GetVariable(vm.handle, module, objectName, 99)
+	return vm.lib.slotValueToGo(vm.handle, 99), nil
+
 }
 
-// HasVariable returns true if the VM has a variable of the given name in the module specified.
+// HasVariable returns true if the VM has a variable of the given name in the module specified. It returns false if
+// the VM has been freed.
 func (vm *VM) HasVariable(module, objectName string) bool {
-	return hasVariable(vm.handle, module, objectName)
+	unlock, err := vm.lock()
+	if err != nil {
+		return false
+	}
+	defer unlock()
+	return vm.hasVariable(CanonicalModuleName("", module), objectName)
 }
 
-// HasModule returns true if the VM contains a module of the given name.
+func (vm *VM) hasVariable(module, objectName string) bool {
+	return !vm.freed && vm.lib.backend.HasModule(vm.handle, module) && vm.lib.backend.HasVariable(vm.handle, module, objectName)
+}
+
+// HasModule returns true if the VM contains a module of the given name. It returns false if the VM has been freed.
 func (vm *VM) HasModule(moduleName string) bool {
-	return hasModule(vm.handle, moduleName)
+	unlock, err := vm.lock()
+	if err != nil {
+		return false
+	}
+	defer unlock()
+	return !vm.freed && vm.lib.backend.HasModule(vm.handle, CanonicalModuleName("", moduleName))
+}
+
+// UserData returns the VM's user data: the value set with SetUserData(), or, if it hasn't been called, the one set
+// with Config.WithUserData(). It returns nil if there isn't one.
+func (vm *VM) UserData() any {
+	if data := vm.userData.Load(); data != nil {
+		return *data
+	}
+	return nil
+}
+
+// SetUserData sets the VM's user data, for this VM only (see Config.WithUserData()).
+func (vm *VM) SetUserData(data any) {
+	vm.userData.Store(&data)
+}
+
+// CollectGarbage runs a full garbage collection in the VM immediately, rather than waiting for the heap to grow.
+// It returns ErrUnsupported if the loaded library doesn't provide wrenCollectGarbage().
+func (vm *VM) CollectGarbage() error {
+	unlock, err := vm.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if vm.freed {
+		return ErrVMFreed
+	}
+	if !vm.lib.capabilities.CollectGarbage {
+		return ErrUnsupported
+	}
+	vm.lib.backend.CollectGarbage(vm.handle)
+	return nil
 }
 
 // func (vm *WrenVM) EnsureSlotCount(slotCount int) {
@@ -554,6 +696,10 @@ type CallHandle struct {
 	callName string
 	module   string
 	object   string
+
+	cleanup  runtime.Cleanup // Releases the handle if it becomes unreachable without being released
+	leak     uint64          // The handle's ID in the leak tracker, if it's tracked
+	released bool
 }
 
 // Call attempts to call the specified function on the object in the given module from the
@@ -573,38 +719,144 @@ type CallHandle struct {
 // - map[any]any (elements must be convertible, of course)
 //
 // The function will return any values returned from the function in Wren, converted to Go types, and
-// an error if the function couldn't be called.
+// an error if the function couldn't be called (a *RuntimeError if the call aborted).
 func (w *CallHandle) Call(args ...any) (any, error) {
+	unlock, err := w.vm.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return w.call(args)
+}
+
+// call calls the function, with the VM locked.
+func (w *CallHandle) call(args []any) (any, error) {
+
+	if w.vm.freed {
+		return nil, ErrVMFreed
+	}
+	if w.released {
+		return nil, ErrHandleReleased
+	}
+
+	if w.vm.reentered() {
+		return nil, ErrVMInUse
+	}
 
 	if len(args) < w.argCount {
 		return nil, fmt.Errorf("error calling function; it requires %d arguments and Call() was provided with %d", w.argCount, len(args))
 	}
 
+	w.vm.lib.backend.EnsureSlots(w.vm.handle, len(args)+1)
+
 	slot := 1
 	for i, arg := range args {
-		if !goValueToSlot(w.vm.handle, slot, arg) {
+		if !w.vm.lib.goValueToSlot(w.vm.handle, slot, arg) {
 			return nil, fmt.Errorf("error converting arguments; argument #%d, ( %v ) cannot be converted", i, arg)
 		}
 		slot++
 	}
 
 	// Put the object (receiver) from the module in the first slot
-	getVariable(w.vm.handle, w.module, w.object, 0)
+	w.vm.lib.backend.GetVariable(w.vm.handle, w.module, w.object, 0)
 
-	res := call(w.vm.handle, w.handle)
+	done := w.vm.collectErrors(w.module)
+	res := w.vm.lib.backend.Call(w.vm.handle, w.handle)
+	w.vm.flushOutput()
 
-	switch res {
-	case 0:
-		return slotValueToGo(w.vm.handle, 0), nil
-		// return &Result{vm: w.vm.handle, slot: 0}, nil
-		// No compilation; it's already compiled, that's what the Handle represents
-	default:
-		return nil, fmt.Errorf("%s:%s:%s: runtime error running script", w.module, w.object, w.callName)
+	// No compilation; it's already compiled, that's what the Handle represents
+	if err := done(res); err != nil {
+		return nil, err
 	}
+
+	return w.vm.lib.slotValueToGo(w.vm.handle, 0), nil
+	// return &Result{vm: w.vm.handle, slot: 0}, nil
 }
 
+// Release releases the CallHandle. Releasing it again, or after its VM has been freed (which releases every
+// CallHandle created from it), does nothing. A CallHandle that becomes unreachable without being released is
+// released automatically, some time after the garbage collector notices.
 func (w *CallHandle) Release() {
-	releaseCallHandle(w.vm.handle, w.handle)
+	unlock, err := w.vm.lock()
+	if err != nil {
+		// The VM can't be used until the call it's running returns, so the handle is released once it does
+		w.vm.later(w.release)
+		return
+	}
+	defer unlock()
+	w.release()
+}
+
+// release releases the CallHandle, whose VM must be locked.
+func (w *CallHandle) release() {
+	if w.released {
+		return
+	}
+	w.released = true
+	w.cleanup.Stop()
+	w.vm.releaseHandle(w.handle)
+	leaks.untrack(w.leak)
+}
+
+// callHandleResources are what has to be released once a CallHandle is released, kept apart from it for the same
+// reason as vmResources.
+type callHandleResources struct {
+	vm     *VM
+	handle uintptr
+	leak   uint64
+}
+
+// cleanUpCallHandle releases a CallHandle that became unreachable without being released, unless its VM has been
+// freed since, taking its handles with it. Cleanups mustn't block, so if the VM is busy, the handle is left for
+// the next call into the VM to release instead.
+func cleanUpCallHandle(r callHandleResources) {
+
+	vm := r.vm
+
+	vm.later(func() {
+		if vm.releaseHandle(r.handle) {
+			leaks.collected(r.leak)
+		}
+	})
+
+	if vm.tryLock() {
+		vm.runPending()
+		vm.unlock()
+	}
+
+}
+
+// later leaves fn to run the next time the VM is locked, for work that can't wait for the VM (such as releasing
+// handles from cleanups, which mustn't block).
+func (vm *VM) later(fn func()) {
+	vm.pendingLock.Lock()
+	defer vm.pendingLock.Unlock()
+	vm.pending = append(vm.pending, fn)
+}
+
+// runPending runs the functions left with later(). The VM must be locked.
+func (vm *VM) runPending() {
+
+	vm.pendingLock.Lock()
+	pending := vm.pending
+	vm.pending = nil
+	vm.pendingLock.Unlock()
+
+	for _, fn := range pending {
+		fn()
+	}
+
+}
+
+// releaseHandle releases one of the VM's call handles, returning false if the VM has already released it (by
+// being freed).
+func (vm *VM) releaseHandle(handle uintptr) bool {
+	if _, ok := vm.handles[handle]; !ok {
+		return false
+	}
+	delete(vm.handles, handle)
+	vm.lib.backend.ReleaseHandle(vm.handle, handle)
+	return true
 }
 
 // func (vm *WrenVM) EnsureSlotCount(slotCount int) {
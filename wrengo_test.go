@@ -0,0 +1,272 @@
+package wrengo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestUserData(t *testing.T) {
+
+	type world struct{ name string }
+	w := &world{name: "overworld"}
+
+	var got any
+	fake, vm := newFakeVM(t, func(cfg Config) Config {
+		return cfg.WithUserData(w).WithForeignMethodResolver(func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction {
+			return func(vm *VM, args []any) any {
+				got = vm.UserData()
+				return nil
+			}
+		})
+	})
+
+	if _, err := fake.CallForeign(vm, "main", "World", "name", true); err != nil {
+		t.Fatal(err)
+	}
+	if got != w {
+		t.Errorf("UserData() in a foreign function = %v; want the configuration's", got)
+	}
+
+	_, other := newFakeVM(t, nil)
+	if data := other.UserData(); data != nil {
+		t.Errorf("UserData() = %v; want nil without any set", data)
+	}
+
+}
+
+func TestFreedVM(t *testing.T) {
+
+	fake, vm := newFakeVM(t, nil)
+
+	fake.SetMethod(vm, "main", "Game", "update()", func(args []any) (any, error) { return nil, nil })
+	released, err := vm.CallHandle("main", "Game", "update()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle, err := vm.CallHandle("main", "Game", "update()")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	released.Release()
+	released.Release() // Releasing a handle again does nothing
+	if _, err := released.Call(); !errors.Is(err, ErrHandleReleased) {
+		t.Errorf("Call() of a released handle returned %v; want ErrHandleReleased", err)
+	}
+
+	if err := vm.Free(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Freeing the VM released its handles, so releasing them now does nothing
+	handle.Release()
+
+	errs := map[string]error{
+		"Free()":         vm.Free(),
+		"Run()":          vm.Run("other", ""),
+		"RunFile()":      vm.RunFile(fstest.MapFS{"other.wren": {}}, "other.wren"),
+		"CollectGarbage": vm.CollectGarbage(),
+		"SetVariable()":  fake.SetVariable(vm, "main", "x", 1),
+	}
+	_, errs["CallHandle()"] = vm.CallHandle("main", "Game", "update()")
+	_, errs["Call()"] = handle.Call()
+
+	for name, err := range errs {
+		if !errors.Is(err, ErrVMFreed) {
+			t.Errorf("%s returned %v; want ErrVMFreed", name, err)
+		}
+	}
+
+	if vm.Variable("main", "Game") != nil || vm.HasVariable("main", "Game") || vm.HasModule("main") {
+		t.Error("the freed VM still reports its variables")
+	}
+
+	if _, err := vm.LookupVariable("main", "Game"); !errors.Is(err, ErrVMFreed) {
+		t.Errorf("LookupVariable() returned %v; want ErrVMFreed", err)
+	}
+	if err := vm.DefineModule("engine").Err(); !errors.Is(err, ErrVMFreed) {
+		t.Errorf("the module defined in the freed VM reports %v; want ErrVMFreed", err)
+	}
+
+}
+
+func TestNotInitialized(t *testing.T) {
+
+	if _, err := NewPool(NewConfig(), 1); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("NewPool() returned %v; want ErrNotInitialized", err)
+	}
+	if _, err := CreateVM(NewConfig()); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("CreateVM() returned %v; want ErrNotInitialized", err)
+	}
+
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrNotInitialized) {
+			t.Errorf("NewVM() panicked with %v; want ErrNotInitialized", err)
+		}
+	}()
+	NewVM(NewConfig())
+
+}
+
+func TestSetUserData(t *testing.T) {
+
+	_, lib := newFakeLibrary(t)
+	cfg := lib.NewConfig().WithUserData("shared")
+
+	a := lib.NewVM(cfg)
+	defer a.Free()
+	b := lib.NewVM(cfg)
+	defer b.Free()
+
+	// Each VM keeps its own user data, even when they're created from the same configuration
+	a.SetUserData("a")
+	if got := a.UserData(); got != "a" {
+		t.Errorf("UserData() = %v; want what was set", got)
+	}
+	if got := b.UserData(); got != "shared" {
+		t.Errorf("UserData() of another VM = %v; want the configuration's", got)
+	}
+
+	a.SetUserData(nil)
+	if got := a.UserData(); got != nil {
+		t.Errorf("UserData() = %v; want nil", got)
+	}
+
+}
+
+func TestLookupVariable(t *testing.T) {
+
+	fake, vm := newFakeVM(t, nil)
+
+	if err := fake.SetVariable(vm, "main", "nothing", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A variable holding null is told apart from one that doesn't exist
+	if value, err := vm.LookupVariable("main", "nothing"); value != nil || err != nil {
+		t.Errorf("LookupVariable() = %v, %v; want nil, nil", value, err)
+	}
+	if _, err := vm.LookupVariable("main", "missing"); err == nil {
+		t.Error("LookupVariable() of a missing variable didn't fail")
+	}
+	if _, err := vm.LookupVariable("missing", "nothing"); err == nil {
+		t.Error("LookupVariable() in a missing module didn't fail")
+	}
+
+}
+
+func TestCreateVMFromClosedLibrary(t *testing.T) {
+
+	_, lib := newFakeLibrary(t)
+	lib.Close()
+
+	if _, err := lib.CreateVM(lib.NewConfig()); !errors.Is(err, ErrLibraryClosed) {
+		t.Errorf("CreateVM() returned %v; want ErrLibraryClosed", err)
+	}
+
+}
+
+func TestCallsFromForeignFunctions(t *testing.T) {
+
+	var errs map[string]error
+	var value any
+
+	fake, vm := newFakeVM(t, func(cfg Config) Config {
+		return cfg.WithForeignMethodResolver(func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction {
+			return func(vm *VM, args []any) any {
+
+				// Looking things up is fine
+				value = vm.Variable("main", "value")
+
+				// But Wren can't run code while it's running a foreign method
+				handle, err := vm.CallHandle("main", "Game", "tick()")
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, callErr := handle.Call()
+				_, callContextErr := handle.CallContext(context.Background())
+				_, evalErr := vm.Eval("main", "value")
+				errs = map[string]error{
+					"Run":         vm.Run("other", ""),
+					"RunFile":     vm.RunFile(fstest.MapFS{"other.wren": {}}, "other.wren"),
+					"RunContext":  vm.RunContext(context.Background(), "other", ""),
+					"Call":        callErr,
+					"CallContext": callContextErr,
+					"Eval":        evalErr,
+					"Free":        vm.Free(),
+				}
+				return nil
+
+			}
+		})
+	})
+
+	fake.SetVariable(vm, "main", "value", 1.0)
+	fake.SetMethod(vm, "main", "Game", "tick()", func(args []any) (any, error) { return nil, nil })
+
+	if _, err := fake.CallForeign(vm, "main", "Game", "update()", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if value != 1.0 {
+		t.Errorf("Variable() from a foreign function = %v; want 1", value)
+	}
+	for name, err := range errs {
+		if !errors.Is(err, ErrVMInUse) {
+			t.Errorf("%s() from a foreign function returned %v; want ErrVMInUse", name, err)
+		}
+	}
+
+	if err := vm.Run("other", ""); err != nil {
+		t.Errorf("Run() once the foreign function returned: %v", err)
+	}
+
+}
+
+func TestCallsFromOtherGoroutines(t *testing.T) {
+
+	var order []string
+	var orderLock sync.Mutex
+	log := func(event string) {
+		orderLock.Lock()
+		order = append(order, event)
+		orderLock.Unlock()
+	}
+
+	other := make(chan struct{})
+
+	fake, vm := newFakeVM(t, func(cfg Config) Config {
+		return cfg.WithForeignMethodResolver(func(vm *VM, module, className, signature string, isStatic bool) GoForeignFunction {
+			return func(vm *VM, args []any) any {
+
+				// Another goroutine calling in while a foreign function runs waits for the VM, rather than
+				// running alongside it
+				go func() {
+					vm.Run("other", "")
+					log("other goroutine")
+					close(other)
+				}()
+
+				time.Sleep(20 * time.Millisecond)
+				log("foreign function")
+				return nil
+
+			}
+		})
+	})
+
+	if _, err := fake.CallForeign(vm, "main", "Game", "update()", true); err != nil {
+		t.Fatal(err)
+	}
+	<-other
+
+	if want := []string{"foreign function", "other goroutine"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("ran %v; want %v", order, want)
+	}
+
+}
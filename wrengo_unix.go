@@ -2,8 +2,50 @@
 
 package wrengo
 
-import "github.com/ebitengine/purego"
+import (
+	"fmt"
+	"runtime"
+	"sync"
 
+	"github.com/ebitengine/purego"
+)
+
+// loadLibrary loads the library with its symbols kept local, so that two builds of Wren loaded side by side each
+// bind to their own functions, rather than the second one's binding to the first one's.
 func loadLibrary(name string) (uintptr, error) {
-	return purego.Dlopen(name, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	return purego.Dlopen(name, purego.RTLD_NOW|purego.RTLD_LOCAL)
+}
+
+func lookupSymbol(lib uintptr, name string) (uintptr, error) {
+	return purego.Dlsym(lib, name)
+}
+
+func closeLibrary(lib uintptr) error {
+	return purego.Dlclose(lib)
+}
+
+// loadCLibrary loads the C standard library, which provides the allocator Wren uses by default.
+func loadCLibrary() (uintptr, error) {
+	if runtime.GOOS == "darwin" {
+		return loadLibrary("/usr/lib/libSystem.B.dylib")
+	}
+	return loadLibrary("libc.so.6")
+}
+
+// pthreadSelf is the address of the C library's pthread_self().
+var pthreadSelf = sync.OnceValue(func() uintptr {
+	libc, err := loadCLibrary()
+	if err == nil {
+		var fn uintptr
+		if fn, err = lookupSymbol(libc, "pthread_self"); err == nil {
+			return fn
+		}
+	}
+	panic(fmt.Errorf("error: could not find pthread_self() in the C library: %w", err))
+})
+
+// currentThread returns the ID of the thread the calling goroutine is running on.
+func currentThread() uintptr {
+	id, _, _ := purego.SyscallN(pthreadSelf())
+	return id
 }
@@ -6,3 +6,26 @@ func loadLibrary(name string) (uintptr, error) {
 	handle, err := syscall.LoadLibrary(name)
 	return uintptr(handle), err
 }
+
+func lookupSymbol(lib uintptr, name string) (uintptr, error) {
+	return syscall.GetProcAddress(syscall.Handle(lib), name)
+}
+
+func closeLibrary(lib uintptr) error {
+	return syscall.FreeLibrary(syscall.Handle(lib))
+}
+
+// loadCLibrary loads the C standard library, which provides the allocator Wren uses by default. The shipped
+// libraries are built against the Universal C Runtime rather than msvcrt.dll, and memory handed to Wren (like
+// canonical module names) has to come from the same heap Wren frees it to.
+func loadCLibrary() (uintptr, error) {
+	return loadLibrary("ucrtbase.dll")
+}
+
+var getCurrentThreadId = syscall.NewLazyDLL("kernel32.dll").NewProc("GetCurrentThreadId")
+
+// currentThread returns the ID of the thread the calling goroutine is running on.
+func currentThread() uintptr {
+	id, _, _ := getCurrentThreadId.Call()
+	return id
+}